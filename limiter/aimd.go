@@ -0,0 +1,108 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+type AIMDOption struct {
+	// Increase is added to the rate on every success, in tokens per second, defaults to 1
+	Increase float64
+	// Decrease multiplies the rate on every overload, between 0 and 1, defaults to 0.5
+	Decrease float64
+	// MinReplenishPerSecond is the floor of the rate, defaults to 1 token per second
+	// The floor never exceeds the rate of the calls.
+	MinReplenishPerSecond float64
+}
+
+// AIMD adapts the rate of the wrapped limiter to the feedback of the caller:
+// additive increase on every success and multiplicative decrease on every overload, e.g. a 429 or a timeout downstream.
+// The replenishPerSecond of the calls is the ceiling of the rate, the rate starts at the ceiling.
+type AIMD struct {
+	inner Limiter
+	opt   AIMDOption
+	mu    sync.Mutex
+	// rate is the adapted rate, zero until the first call
+	rate float64
+	// ceiling is the rate of the latest call
+	ceiling float64
+}
+
+var _ DetailedLimiter = &AIMD{}
+var _ Replenisher = &AIMD{}
+
+// NewAIMD wraps inner, e.g. a ResetBasedLimiter or a Bucket, with an adaptive rate
+func NewAIMD(inner Limiter, opt AIMDOption) *AIMD {
+	if opt.Increase <= 0 {
+		opt.Increase = 1
+	}
+	if opt.Decrease <= 0 || opt.Decrease >= 1 {
+		opt.Decrease = 0.5
+	}
+	if opt.MinReplenishPerSecond <= 0 {
+		opt.MinReplenishPerSecond = 1
+	}
+	return &AIMD{inner: inner, opt: opt}
+}
+
+func (l *AIMD) AllowN(n int, replenishPerSecond float64, burst int) bool {
+	return l.inner.AllowN(n, l.adapt(replenishPerSecond), burst)
+}
+
+func (l *AIMD) ForceN(n int, replenishPerSecond float64, burst int) bool {
+	return l.inner.ForceN(n, l.adapt(replenishPerSecond), burst)
+}
+
+func (l *AIMD) ReserveN(n int, replenishPerSecond float64, burst int) *Reservation {
+	return l.inner.ReserveN(n, l.adapt(replenishPerSecond), burst)
+}
+
+func (l *AIMD) AllowNDetailed(n int, replenishPerSecond float64, burst int) Result {
+	return AllowNDetailed(l.inner, n, l.adapt(replenishPerSecond), burst)
+}
+
+// IsReplenished reports whether the wrapped limiter is replenished, it is false if the wrapped limiter cannot tell
+func (l *AIMD) IsReplenished(t time.Time) bool {
+	r, ok := l.inner.(Replenisher)
+	return ok && r.IsReplenished(t)
+}
+
+// OnSuccess increases the rate by `AIMDOption.Increase`, up to the rate of the calls
+func (l *AIMD) OnSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate > 0 {
+		l.rate = min(l.rate+l.opt.Increase, l.ceiling)
+	}
+}
+
+// OnOverload multiplies the rate by `AIMDOption.Decrease`, down to `AIMDOption.MinReplenishPerSecond`
+func (l *AIMD) OnOverload() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate > 0 {
+		l.rate = max(l.rate*l.opt.Decrease, min(l.opt.MinReplenishPerSecond, l.ceiling))
+	}
+}
+
+// Rate returns the adapted rate, it is zero until the first call
+func (l *AIMD) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// adapt records the rate of the call as the ceiling and returns the adapted rate
+func (l *AIMD) adapt(replenishPerSecond float64) float64 {
+	if Validate(0, replenishPerSecond, 0) != nil {
+		// Left to the wrapped limiter to deny
+		return replenishPerSecond
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ceiling = replenishPerSecond
+	if l.rate == 0 || l.rate > replenishPerSecond {
+		l.rate = replenishPerSecond
+	}
+	return l.rate
+}
@@ -6,34 +6,101 @@ import (
 	"golang.org/x/time/rate"
 )
 
+var _ DetailedLimiter = &BuiltinLimiter{}
+var _ Replenisher = &BuiltinLimiter{}
+
 type BuiltinLimiter struct {
 	*rate.Limiter
+	clock Clock
 }
 
 func NewBuiltinLimiter(replenishPerSecond float64, burst int) *BuiltinLimiter {
+	return NewBuiltinLimiterWithClock(replenishPerSecond, burst, SystemClock)
+}
+
+// NewBuiltinLimiterWithClock is NewBuiltinLimiter with time read from clock and passed to the `*At` methods of `rate.Limiter`
+func NewBuiltinLimiterWithClock(replenishPerSecond float64, burst int, clock Clock) *BuiltinLimiter {
 	return &BuiltinLimiter{
 		Limiter: rate.NewLimiter(rate.Limit(replenishPerSecond), burst),
+		clock:   orSystemClock(clock),
 	}
 }
 
 func (d *BuiltinLimiter) AllowN(n int, replenishPerSecond float64, burst int) bool {
-	d.setRate(replenishPerSecond, burst)
-	return d.Limiter.AllowN(time.Now(), n)
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return false
+	}
+	now := d.now()
+	d.setRate(now, replenishPerSecond, burst)
+	return d.Limiter.AllowN(now, n)
 }
 
 func (d *BuiltinLimiter) ForceN(n int, replenishPerSecond float64, burst int) bool {
-	d.setRate(replenishPerSecond, burst)
-	return d.Limiter.ReserveN(time.Now(), n).OK()
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return false
+	}
+	now := d.now()
+	d.setRate(now, replenishPerSecond, burst)
+	return d.Limiter.ReserveN(now, n).OK()
+}
+
+// ReserveN delegates to `rate.Limiter.ReserveN`.
+// Cancelling the reservation follows `rate.Reservation.Cancel`, which has no effect once the time to act has passed.
+func (d *BuiltinLimiter) ReserveN(n int, replenishPerSecond float64, burst int) *Reservation {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return &Reservation{}
+	}
+	now := d.now()
+	d.setRate(now, replenishPerSecond, burst)
+	r := d.Limiter.ReserveN(now, n)
+	if !r.OK() {
+		return &Reservation{}
+	}
+	return newReservation(d.clock, now.Add(r.DelayFrom(now)), func() { r.CancelAt(d.now()) })
+}
+
+// AllowNDetailed is AllowN that also reports the tokens left in the underlying `rate.Limiter`
+func (d *BuiltinLimiter) AllowNDetailed(n int, replenishPerSecond float64, burst int) Result {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return Result{RetryAfter: -1}
+	}
+	now := d.now()
+	d.setRate(now, replenishPerSecond, burst)
+	res := Result{Allowed: d.Limiter.AllowN(now, n)}
+	tokens := d.Limiter.TokensAt(now)
+	res.Remaining = int(max(tokens, 0))
+	res.ResetAt = now
+	limit := float64(d.Limiter.Limit())
+	if !res.Allowed {
+		if n > burst || limit <= 0 {
+			res.RetryAfter = -1
+		} else {
+			res.RetryAfter = secondsToDuration((float64(n) - tokens) / limit)
+		}
+	}
+	if limit > 0 && d.Limiter.Limit() != rate.Inf && tokens < float64(burst) {
+		res.ResetAt = now.Add(secondsToDuration((float64(burst) - tokens) / limit))
+	}
+	return res
+}
+
+// IsReplenished reports whether the underlying `rate.Limiter` has a full burst of tokens at t
+func (d *BuiltinLimiter) IsReplenished(t time.Time) bool {
+	return d.Limiter.TokensAt(t) >= float64(d.Limiter.Burst())
+}
+
+func (d *BuiltinLimiter) now() time.Time {
+	return orSystemClock(d.clock).Now()
 }
 
-func (d *BuiltinLimiter) setRate(limit float64, burst int) bool {
+func (d *BuiltinLimiter) setRate(now time.Time, limit float64, burst int) bool {
 	modified := false
 	if d.Limiter.Burst() != burst {
-		d.Limiter.SetBurst(burst)
+		d.Limiter.SetBurstAt(now, burst)
 		modified = true
 	}
 	if d.Limiter.Limit() != rate.Limit(limit) {
-		d.Limiter.SetLimit(rate.Limit(limit))
+		d.Limiter.SetLimitAt(now, rate.Limit(limit))
 		modified = true
 	}
 	return modified
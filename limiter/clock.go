@@ -0,0 +1,25 @@
+package limiter
+
+import "time"
+
+// Clock is the source of time of the limiters.
+// Inject a fake clock, e.g. `limitertest.ManualClock`, to test rate-limit behaviour without wall-clock sleeps.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock backed by `time.Now`, it is used when no clock is given
+var SystemClock Clock = systemClock{}
+
+func orSystemClock(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock
+	}
+	return clock
+}
@@ -0,0 +1,45 @@
+package limiter
+
+import "sync"
+
+// Concurrency caps the number of units of work in flight rather than the throughput.
+// Every successful AcquireN must be followed by a ReleaseN of the same n once the work is done.
+type Concurrency struct {
+	mu       sync.Mutex
+	inFlight int
+}
+
+func NewConcurrency() *Concurrency {
+	return &Concurrency{}
+}
+
+// AcquireN takes n slots if at most limit slots end up in flight, a negative n is denied
+func (c *Concurrency) AcquireN(n int, limit int) bool {
+	if n < 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight+n > limit {
+		return false
+	}
+	c.inFlight += n
+	return true
+}
+
+// ReleaseN gives n slots back, the slots in flight never go below zero and a negative n takes none
+func (c *Concurrency) ReleaseN(n int) {
+	if n < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight = max(c.inFlight-n, 0)
+}
+
+// InFlight returns the number of slots taken
+func (c *Concurrency) InFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inFlight
+}
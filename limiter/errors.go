@@ -0,0 +1,18 @@
+package limiter
+
+import "errors"
+
+var (
+	// ErrExceedsBurst is returned when the requested number of tokens can never be granted because it is larger than burst
+	ErrExceedsBurst = errors.New("limiter: n exceeds burst")
+	// ErrWaitExceedsDeadline is returned when waiting for the requested tokens would outlast the context deadline
+	ErrWaitExceedsDeadline = errors.New("limiter: wait would exceed context deadline")
+	// ErrInvalidRate is returned when replenishPerSecond is zero, negative or NaN
+	ErrInvalidRate = errors.New("limiter: invalid rate")
+	// ErrInvalidBurst is returned when burst is negative
+	ErrInvalidBurst = errors.New("limiter: invalid burst")
+	// ErrNegativeCost is returned when n is negative, which would give tokens back
+	ErrNegativeCost = errors.New("limiter: negative cost")
+	// ErrReturnNotSupported is returned when tokens are given back to a limiter that does not implement Returner
+	ErrReturnNotSupported = errors.New("limiter: return not supported")
+)
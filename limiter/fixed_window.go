@@ -0,0 +1,217 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type FixedWindowOption struct {
+	// Window is the length of the windows, it defaults to burst/replenishPerSecond of the call
+	// The replenishPerSecond of the calls is still validated when Window is set, see `Validate`.
+	// e.g. `time.Minute` with a burst of 100 allows 100 tokens per calendar minute
+	Window time.Duration
+	// Offset shifts the windows from the multiples of Window since the Unix epoch, the windows are aligned to UTC boundaries without it
+	// e.g. an Offset of 30 minutes with a Window of `time.Hour` starts the windows at :30
+	Offset time.Duration
+}
+
+// FixedWindow allows burst tokens per window, the count restarts from zero at the start of every window.
+// The windows are aligned to wall-clock boundaries, so the quota of every key resets at the same time.
+type FixedWindow struct {
+	mu  sync.Mutex
+	opt FixedWindowOption
+	// counts of the current window and of the windows holding reservations, sorted by start
+	windows []windowCount
+	// window of the latest call, used to tell whether the limiter is replenished
+	window int64
+	clock  Clock
+}
+
+type windowCount struct {
+	start int64
+	count int
+}
+
+var _ DetailedLimiter = &FixedWindow{}
+var _ Replenisher = &FixedWindow{}
+var _ Returner = &FixedWindow{}
+
+func NewFixedWindow(opt FixedWindowOption) *FixedWindow {
+	return NewFixedWindowWithClock(opt, SystemClock)
+}
+
+// NewFixedWindowWithClock is NewFixedWindow with time read from clock
+func NewFixedWindowWithClock(opt FixedWindowOption, clock Clock) *FixedWindow {
+	return &FixedWindow{opt: opt, clock: orSystemClock(clock)}
+}
+
+func (l *FixedWindow) now() int64 {
+	return orSystemClock(l.clock).Now().UnixNano()
+}
+
+func (l *FixedWindow) AllowN(n int, replenishPerSecond float64, burst int) bool {
+	return l.allowN(n, replenishPerSecond, burst, true)
+}
+
+func (l *FixedWindow) ForceN(n int, replenishPerSecond float64, burst int) bool {
+	return l.allowN(n, replenishPerSecond, burst, false)
+}
+
+func (l *FixedWindow) allowN(n int, replenishPerSecond float64, burst int, shouldCheck bool) bool {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return false
+	}
+	if shouldCheck && n > burst {
+		return false
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	start := l.advance(now, replenishPerSecond, burst)
+	if shouldCheck && l.count(start)+n > burst {
+		return false
+	}
+	l.add(start, n)
+	return true
+}
+
+// ReserveN counts the tokens in the first window with room for them.
+// Cancelling the reservation removes the tokens from that window if it has not ended.
+func (l *FixedWindow) ReserveN(n int, replenishPerSecond float64, burst int) *Reservation {
+	if n > burst || Validate(n, replenishPerSecond, burst) != nil {
+		return &Reservation{}
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	start := l.availableIn(l.advance(now, replenishPerSecond, burst), n, burst)
+	l.add(start, n)
+	return newReservation(l.clock, time.Unix(0, max(start, now)), func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.add(start, -n)
+	})
+}
+
+// AllowNDetailed is AllowN that also reports the room left in the current window and when the windows in use end
+func (l *FixedWindow) AllowNDetailed(n int, replenishPerSecond float64, burst int) Result {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return Result{RetryAfter: -1}
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	start := l.advance(now, replenishPerSecond, burst)
+	res := Result{}
+	switch {
+	case n > burst:
+		res.RetryAfter = -1
+	case l.count(start)+n > burst:
+		res.RetryAfter = time.Duration(l.availableIn(start, n, burst) - now)
+	default:
+		l.add(start, n)
+		res.Allowed = true
+	}
+	res.Remaining = max(burst-l.count(start), 0)
+	res.ResetAt = time.Unix(0, start+l.window)
+	if len(l.windows) > 0 {
+		res.ResetAt = time.Unix(0, max(l.windows[len(l.windows)-1].start+l.window, now))
+	}
+	return res
+}
+
+// ReturnN removes n tokens from the current window, the windows holding reservations are left as they are
+func (l *FixedWindow) ReturnN(n int) {
+	if n <= 0 {
+		return
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.window <= 0 {
+		return
+	}
+	l.add(l.windowStart(now), -n)
+}
+
+// IsReplenished reports whether every window in use has ended at t
+func (l *FixedWindow) IsReplenished(t time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.windows) == 0 || l.windows[len(l.windows)-1].start+l.window <= t.UnixNano()
+}
+
+// advance drops the windows that have ended and returns the start of the window of now
+func (l *FixedWindow) advance(now int64, replenishPerSecond float64, burst int) int64 {
+	l.window = int64(l.opt.Window)
+	if l.window <= 0 {
+		l.window = int64(math.Round(float64(burst) / replenishPerSecond * float64(time.Second)))
+	}
+	if l.window <= 0 {
+		// Every call gets a window of its own
+		l.windows = l.windows[:0]
+		return now
+	}
+	i := 0
+	for i < len(l.windows) && l.windows[i].start+l.window <= now {
+		i++
+	}
+	if i == len(l.windows) {
+		// Reuse the backing array when every window has ended
+		l.windows = l.windows[:0]
+	} else {
+		l.windows = l.windows[i:]
+	}
+	return l.windowStart(now)
+}
+
+// windowStart returns the start of the window of now
+func (l *FixedWindow) windowStart(now int64) int64 {
+	offset := int64(l.opt.Offset) % l.window
+	// The remainder is negative before the epoch, keep the window start at or before now
+	elapsed := (now - offset) % l.window
+	if elapsed < 0 {
+		elapsed += l.window
+	}
+	return now - elapsed
+}
+
+// availableIn returns the start of the first window from start with room for n tokens
+func (l *FixedWindow) availableIn(start int64, n int, burst int) int64 {
+	for l.window > 0 && l.count(start)+n > burst {
+		start += l.window
+	}
+	return start
+}
+
+func (l *FixedWindow) count(start int64) int {
+	for _, w := range l.windows {
+		if w.start == start {
+			return w.count
+		}
+	}
+	return 0
+}
+
+// add keeps the windows sorted and drops a window once its count is back to zero
+func (l *FixedWindow) add(start int64, n int) {
+	for i := range l.windows {
+		switch {
+		case l.windows[i].start == start:
+			l.windows[i].count += n
+			if l.windows[i].count <= 0 {
+				l.windows = append(l.windows[:i], l.windows[i+1:]...)
+			}
+			return
+		case l.windows[i].start > start:
+			if n > 0 {
+				l.windows = append(l.windows[:i], append([]windowCount{{start: start, count: n}}, l.windows[i:]...)...)
+			}
+			return
+		}
+	}
+	if n > 0 {
+		l.windows = append(l.windows, windowCount{start: start, count: n})
+	}
+}
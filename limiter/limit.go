@@ -0,0 +1,72 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a rate with the burst allowed on top of it
+type Limit struct {
+	ReplenishPerSecond float64
+	Burst              int
+}
+
+// Policy is a set of limits checked together, e.g. 10 per second and 1000 per hour.
+// A request is allowed only if every limit allows it.
+type Policy []Limit
+
+// PerSecond allows n tokens per second, with a burst of n
+func PerSecond(n int) Limit {
+	return Limit{ReplenishPerSecond: float64(n), Burst: n}
+}
+
+// PerMinute allows n tokens per minute, with a burst of n
+func PerMinute(n int) Limit {
+	return Limit{ReplenishPerSecond: float64(n) / 60, Burst: n}
+}
+
+// PerHour allows n tokens per hour, with a burst of n
+func PerHour(n int) Limit {
+	return Limit{ReplenishPerSecond: float64(n) / 3600, Burst: n}
+}
+
+// Every allows a token every d, with a burst of 1
+// A zero or negative d is an infinite rate.
+func Every(d time.Duration) Limit {
+	if d <= 0 {
+		return Limit{ReplenishPerSecond: math.Inf(1), Burst: 1}
+	}
+	return Limit{ReplenishPerSecond: float64(time.Second) / float64(d), Burst: 1}
+}
+
+// WithBurst returns the limit with its burst replaced by burst
+func (l Limit) WithBurst(burst int) Limit {
+	l.Burst = burst
+	return l
+}
+
+// AllowNLimit is `Limiter.AllowN` with a Limit
+func AllowNLimit(l Limiter, n int, limit Limit) bool {
+	return l.AllowN(n, limit.ReplenishPerSecond, limit.Burst)
+}
+
+// ForceNLimit is `Limiter.ForceN` with a Limit
+func ForceNLimit(l Limiter, n int, limit Limit) bool {
+	return l.ForceN(n, limit.ReplenishPerSecond, limit.Burst)
+}
+
+// ReserveNLimit is `Limiter.ReserveN` with a Limit
+func ReserveNLimit(l Limiter, n int, limit Limit) *Reservation {
+	return l.ReserveN(n, limit.ReplenishPerSecond, limit.Burst)
+}
+
+// AllowNDetailedLimit is AllowNDetailed with a Limit
+func AllowNDetailedLimit(l Limiter, n int, limit Limit) Result {
+	return AllowNDetailed(l, n, limit.ReplenishPerSecond, limit.Burst)
+}
+
+// WaitNLimit is WaitN with a Limit
+func WaitNLimit(ctx context.Context, l Limiter, n int, limit Limit) error {
+	return WaitN(ctx, l, n, limit.ReplenishPerSecond, limit.Burst)
+}
@@ -3,4 +3,19 @@ package limiter
 type Limiter interface {
 	AllowN(int, float64, int) bool
 	ForceN(int, float64, int) bool
+	ReserveN(int, float64, int) *Reservation
+}
+
+// SyncableLimiter is a Limiter whose consumption can be exchanged with other servers as nanoseconds of a resetAt,
+// it is the local state behind `ratelimit.RedisDelayedSync`.
+type SyncableLimiter interface {
+	Limiter
+	// GetResetAt returns the time in nanoseconds until which the consumed tokens are accounted for
+	GetResetAt() int64
+	// IncrementResetAtBy applies the consumption of other servers
+	IncrementResetAtBy(int64)
+	// PopResetAtDelta returns and clears the consumption of this server since the last pop
+	PopResetAtDelta() int64
+	// AddDeltaSinceLastPop puts back a popped delta that could not be pushed
+	AddDeltaSinceLastPop(int64)
 }
@@ -18,6 +18,9 @@ func BenchmarkLimiter(b *testing.B) {
 		{name: "Bucket", limiter: NewBucket()},
 		{name: "BuiltinLimiter", limiter: NewBuiltinLimiter(r, burst)},
 		{name: "ResetBasedLimiter", limiter: NewResetbasedLimiter()},
+		{name: "SlidingWindowLog", limiter: NewSlidingWindowLog()},
+		{name: "SlidingWindowCounter", limiter: NewSlidingWindowCounter()},
+		{name: "FixedWindow", limiter: NewFixedWindow(FixedWindowOption{})},
 	}
 
 	for _, numberOfGoroutines := range []int{1, 8, 32} {
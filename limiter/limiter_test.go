@@ -1,35 +1,54 @@
 package limiter
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/yesyoukenspace/go-ratelimit/internal/test_utils"
+	"github.com/yesyoukenspace/go-ratelimit/limiter/limitertest"
 )
 
 var limiters = []struct {
 	name         string
-	newLimiterFn func(replenishPerSecond float64, burst int) Limiter
+	newLimiterFn func(replenishPerSecond float64, burst int, clock Clock) Limiter
+	// window is how the limiter forgets the consumed tokens, "" when they replenish continuously,
+	// otherwise the sliding window ("log" or "counter") of burst/replenishPerSecond they have to leave
+	window string
 }{
 	{
 		name: "golang.org/x/time/rate",
-		newLimiterFn: func(replenishPerSecond float64, burst int) Limiter {
-			return NewBuiltinLimiter(replenishPerSecond, burst)
+		newLimiterFn: func(replenishPerSecond float64, burst int, clock Clock) Limiter {
+			return NewBuiltinLimiterWithClock(replenishPerSecond, burst, clock)
 		},
 	},
 	{
 		name: "Bucket",
-		newLimiterFn: func(replenishPerSecond float64, burst int) Limiter {
-			return NewBucket()
+		newLimiterFn: func(replenishPerSecond float64, burst int, clock Clock) Limiter {
+			return NewBucketWithClock(clock)
 		},
 	},
 	{
 		name: "ResetbasedLimiter",
-		newLimiterFn: func(replenishPerSecond float64, burst int) Limiter {
-			return NewResetbasedLimiter()
+		newLimiterFn: func(replenishPerSecond float64, burst int, clock Clock) Limiter {
+			return NewResetbasedLimiterWithClock(clock)
 		},
 	},
+	{
+		name: "SlidingWindowLog",
+		newLimiterFn: func(replenishPerSecond float64, burst int, clock Clock) Limiter {
+			return NewSlidingWindowLogWithClock(clock)
+		},
+		window: "log",
+	},
+	{
+		name: "SlidingWindowCounter",
+		newLimiterFn: func(replenishPerSecond float64, burst int, clock Clock) Limiter {
+			return NewSlidingWindowCounterWithClock(clock)
+		},
+		window: "counter",
+	},
 }
 
 type testLimiterConfig struct {
@@ -37,49 +56,75 @@ type testLimiterConfig struct {
 	burst              int
 	runPattern         []time.Duration
 	expectedAllowed    int
-	tolerance          float64
+	// windowAllowed is expectedAllowed of the sliding window limiters by window.
+	// The counter fills its first window, then lets in the tokens of the weighted previous window as they leave it,
+	// all of them but the last one of a full window since the previous window still weighs a little at the last attempt.
+	windowAllowed map[string]int
+	tolerance     float64
 }
 
-func TestLimiterAllow(t *testing.T) {
-	tests := []testLimiterConfig{
-		{
-			replenishPerSecond: 100,
-			burst:              100,
-			// 2 seconds of run
-			runPattern:      []time.Duration{2 * time.Second},
-			expectedAllowed: 300,
-			tolerance:       0.001,
-		},
-		{
-			replenishPerSecond: 100,
-			burst:              10,
-			runPattern:         []time.Duration{1 * time.Second, 1 * time.Second, 2 * time.Second},
-			expectedAllowed:    320,
-			tolerance:          0.01,
-		},
-		{
-			replenishPerSecond: 10,
-			burst:              100,
-			runPattern:         []time.Duration{1 * time.Second, 11 * time.Second, 2 * time.Second},
-			expectedAllowed:    230,
-			tolerance:          0.01,
-		},
-		{
-			replenishPerSecond: 500,
-			burst:              1000,
-			runPattern:         []time.Duration{2 * time.Second, 1 * time.Second, 2 * time.Second},
-			expectedAllowed:    3500,
-			tolerance:          0.01,
-		},
+func (tt testLimiterConfig) expected(window string) int {
+	if window != "" {
+		return tt.windowAllowed[window]
 	}
+	return tt.expectedAllowed
+}
+
+var limiterAllowTests = []testLimiterConfig{
+	{
+		replenishPerSecond: 100,
+		burst:              100,
+		// 2 seconds of run
+		runPattern:      []time.Duration{2 * time.Second},
+		expectedAllowed: 300,
+		// counter: 100 in the first window of 1s, 99 in the second
+		windowAllowed: map[string]int{"log": 200, "counter": 199},
+		tolerance:     0.001,
+	},
+	{
+		replenishPerSecond: 100,
+		burst:              10,
+		runPattern:         []time.Duration{1 * time.Second, 1 * time.Second, 2 * time.Second},
+		expectedAllowed:    320,
+		// counter: windows of 100ms, 10 in the first one of each run and 9 in the 9 and 19 others
+		windowAllowed: map[string]int{"log": 300, "counter": 272},
+		tolerance:     0.01,
+	},
+	{
+		replenishPerSecond: 10,
+		burst:              100,
+		runPattern:         []time.Duration{1 * time.Second, 11 * time.Second, 2 * time.Second},
+		expectedAllowed:    230,
+		// counter: 100 in the first window of 10s, the second window runs from 20% to 40% of it
+		// while the weight of the previous window drops from 80 to 60, letting in 39
+		windowAllowed: map[string]int{"log": 200, "counter": 139},
+		tolerance:     0.01,
+	},
+	{
+		replenishPerSecond: 500,
+		burst:              1000,
+		runPattern:         []time.Duration{2 * time.Second, 1 * time.Second, 2 * time.Second},
+		expectedAllowed:    3500,
+		// counter: 1000 in the first window of 2s, 999 in the second from its middle on,
+		// and 500 in the first half of the third as the 999 of the second weigh half
+		windowAllowed: map[string]int{"log": 2000, "counter": 2499},
+		tolerance:     0.01,
+	},
+}
 
+func TestLimiterAllow(t *testing.T) {
 	for _, limiterConfig := range limiters {
-		for _, tt := range tests {
+		if limiterConfig.window == "counter" {
+			// The count of the counter depends on when the attempts fall in its windows, which the ticker does not keep under load,
+			// see TestLimiterAllowManualClock
+			continue
+		}
+		for _, tt := range limiterAllowTests {
 			t.Run(fmt.Sprintf("limiter=%s;rps=%2f;burst=%d", limiterConfig.name, tt.replenishPerSecond, tt.burst), func(t *testing.T) {
 				t.Parallel()
 				allowed := 0
 				denied := 0
-				limiter := limiterConfig.newLimiterFn(tt.replenishPerSecond, tt.burst)
+				limiter := limiterConfig.newLimiterFn(tt.replenishPerSecond, tt.burst, SystemClock)
 
 				for i, runFor := range tt.runPattern {
 					if i%2 == 1 {
@@ -104,8 +149,9 @@ func TestLimiterAllow(t *testing.T) {
 					}
 				}
 
-				if !test_utils.IsCloseEnough(float64(tt.expectedAllowed), float64(allowed), tt.tolerance) {
-					t.Errorf("expected %d, got %d", tt.expectedAllowed, allowed)
+				expectedAllowed := tt.expected(limiterConfig.window)
+				if !test_utils.IsCloseEnough(float64(expectedAllowed), float64(allowed), tt.tolerance) {
+					t.Errorf("expected %d, got %d", expectedAllowed, allowed)
 				}
 				if denied < 1 {
 					t.Errorf("expected >%d denials, got %d", 1, denied)
@@ -114,3 +160,449 @@ func TestLimiterAllow(t *testing.T) {
 		}
 	}
 }
+
+// TestLimiterAllowManualClock runs the same patterns as TestLimiterAllow on a manual clock, one attempt every 0.5ms
+func TestLimiterAllowManualClock(t *testing.T) {
+	for _, limiterConfig := range limiters {
+		for _, tt := range limiterAllowTests {
+			t.Run(fmt.Sprintf("limiter=%s;rps=%2f;burst=%d", limiterConfig.name, tt.replenishPerSecond, tt.burst), func(t *testing.T) {
+				t.Parallel()
+				allowed := 0
+				denied := 0
+				clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+				limiter := limiterConfig.newLimiterFn(tt.replenishPerSecond, tt.burst, clock)
+
+				for i, runFor := range tt.runPattern {
+					if i%2 == 1 {
+						clock.Advance(runFor)
+						continue
+					}
+					for range runFor / (time.Millisecond / 2) {
+						clock.Advance(time.Millisecond / 2)
+						if limiter.AllowN(1, tt.replenishPerSecond, tt.burst) {
+							allowed++
+						} else {
+							denied++
+						}
+					}
+				}
+
+				expectedAllowed := tt.expected(limiterConfig.window)
+				if !test_utils.IsCloseEnough(float64(expectedAllowed), float64(allowed), tt.tolerance) {
+					t.Errorf("expected %d, got %d", expectedAllowed, allowed)
+				}
+				if denied < 1 {
+					t.Errorf("expected >%d denials, got %d", 1, denied)
+				}
+			})
+		}
+	}
+}
+
+func TestLimiterReserve(t *testing.T) {
+	replenishPerSecond := 10.0
+	burst := 10
+	for _, limiterConfig := range limiters {
+		t.Run(fmt.Sprintf("limiter=%s", limiterConfig.name), func(t *testing.T) {
+			t.Parallel()
+			clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+			limiter := limiterConfig.newLimiterFn(replenishPerSecond, burst, clock)
+			// 5 tokens replenish in 500ms, a sliding window log frees them once the whole window of 1s has passed
+			// and a sliding window counter once half of the burst has left the weighted previous window
+			wait := map[string]time.Duration{"": 500 * time.Millisecond, "log": time.Second, "counter": 1500 * time.Millisecond}[limiterConfig.window]
+
+			if r := limiter.ReserveN(burst+1, replenishPerSecond, burst); r.OK() || r.Delay() != InfDuration {
+				t.Fatalf("reservation exceeding burst should not be ok")
+			}
+			if r := limiter.ReserveN(burst, replenishPerSecond, burst); !r.OK() || r.Delay() != 0 {
+				t.Fatalf("expected reservation to be ok without delay, got ok=%t delay=%s", r.OK(), r.Delay())
+			}
+			r := limiter.ReserveN(5, replenishPerSecond, burst)
+			if !r.OK() {
+				t.Fatalf("expected reservation to be ok")
+			}
+			if !test_utils.IsCloseEnough(float64(wait), float64(r.Delay()), 0.05) {
+				t.Fatalf("expected delay close to %s, got %s", wait, r.Delay())
+			}
+			if !r.TimeToAct().After(clock.Now()) {
+				t.Fatalf("expected time to act to be in the future, got %s", r.TimeToAct())
+			}
+			r.Cancel()
+			r.Cancel()
+			// The cancelled tokens are given back, so the next reservation waits as long as the cancelled one
+			r = limiter.ReserveN(5, replenishPerSecond, burst)
+			if !test_utils.IsCloseEnough(float64(wait), float64(r.Delay()), 0.05) {
+				t.Fatalf("expected delay close to %s after cancel, got %s", wait, r.Delay())
+			}
+			if limiterConfig.window != "" {
+				return
+			}
+
+			// Like `rate.Reservation.CancelAt`, the tokens that a later reservation waits for are not given back
+			limiter = limiterConfig.newLimiterFn(1, 1, clock)
+			limiter.AllowN(1, 1, 1)
+			a := limiter.ReserveN(1, 1, 1)
+			if b := limiter.ReserveN(1, 1, 1); a.Delay() != time.Second || b.Delay() != 2*time.Second {
+				t.Fatalf("expected delays of 1s and 2s, got %s and %s", a.Delay(), b.Delay())
+			}
+			a.Cancel()
+			if c := limiter.ReserveN(1, 1, 1); c.Delay() != 3*time.Second {
+				t.Fatalf("expected delay of 3s after cancelling a reservation that a later one waits for, got %s", c.Delay())
+			}
+		})
+	}
+}
+
+func TestLimiterAllowNDetailed(t *testing.T) {
+	replenishPerSecond := 10.0
+	burst := 10
+	for _, limiterConfig := range limiters {
+		t.Run(fmt.Sprintf("limiter=%s", limiterConfig.name), func(t *testing.T) {
+			t.Parallel()
+			clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+			limiter := limiterConfig.newLimiterFn(replenishPerSecond, burst, clock)
+			resetIn, retryAfter := 400*time.Millisecond, 200*time.Millisecond
+			switch limiterConfig.window {
+			case "log":
+				resetIn, retryAfter = time.Second, time.Second
+			case "counter":
+				// The tokens of the current window are weighted down during the next window
+				resetIn, retryAfter = 2*time.Second, 1500*time.Millisecond
+			}
+
+			res := AllowNDetailed(limiter, 4, replenishPerSecond, burst)
+			if !res.Allowed || res.Remaining != 6 || res.RetryAfter != 0 {
+				t.Fatalf("expected allowed with 6 remaining, got %+v", res)
+			}
+			if got := res.ResetAt.Sub(clock.Now()); !test_utils.IsCloseEnough(float64(resetIn), float64(got), 0.05) {
+				t.Fatalf("expected reset in %s, got %s", resetIn, got)
+			}
+
+			res = AllowNDetailed(limiter, 8, replenishPerSecond, burst)
+			if res.Allowed || res.Remaining != 6 {
+				t.Fatalf("expected denied with 6 remaining, got %+v", res)
+			}
+			if !test_utils.IsCloseEnough(float64(retryAfter), float64(res.RetryAfter), 0.05) {
+				t.Fatalf("expected retry after %s, got %s", retryAfter, res.RetryAfter)
+			}
+
+			if res = AllowNDetailed(limiter, burst+1, replenishPerSecond, burst); res.Allowed || res.RetryAfter != -1 {
+				t.Fatalf("expected denied with retry after -1, got %+v", res)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowCounterSync(t *testing.T) {
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter := NewSlidingWindowCounterWithClock(clock)
+
+	// Consumption synced before the first call is counted once the rate is known
+	limiter.IncrementResetAtBy(int64(6 * 100 * time.Millisecond))
+	if !limiter.AllowN(4, 10, 10) {
+		t.Fatalf("expected 4 tokens to be allowed")
+	}
+	if limiter.AllowN(1, 10, 10) {
+		t.Fatalf("expected the synced tokens to count in the window")
+	}
+	if delta := limiter.PopResetAtDelta(); delta != int64(4*100*time.Millisecond) {
+		t.Fatalf("expected a delta of 400ms, got %s", time.Duration(delta))
+	}
+	limiter.IncrementResetAtBy(-int64(2 * 100 * time.Millisecond))
+	if !limiter.AllowN(2, 10, 10) {
+		t.Fatalf("expected 2 tokens to be allowed after a negative increment")
+	}
+}
+
+func TestSlidingWindowCounterWindows(t *testing.T) {
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, int(500*time.Millisecond), time.UTC))
+	first := NewSlidingWindowCounterWithClock(clock)
+	first.AllowN(1, 10, 10)
+	clock.Advance(400 * time.Millisecond)
+	second := NewSlidingWindowCounterWithClock(clock)
+	second.AllowN(1, 10, 10)
+	// Both limiters start the 1s window on the second boundary, whatever the time of their first call
+	windowStart := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	if first.start != windowStart || second.start != windowStart {
+		t.Fatalf("expected the windows to start at %d, got %d and %d", windowStart, first.start, second.start)
+	}
+
+	// Cancelling a reservation whose window has left the sliding window gives nothing back
+	reservation := first.ReserveN(1, 10, 10)
+	resetAt := first.GetResetAt()
+	_ = first.PopResetAtDelta()
+	clock.Advance(3 * time.Second)
+	reservation.Cancel()
+	if got := first.GetResetAt(); got != resetAt {
+		t.Fatalf("expected resetAt to stay at %d, got %d", resetAt, got)
+	}
+	if delta := first.PopResetAtDelta(); delta != 0 {
+		t.Fatalf("expected no delta, got %s", time.Duration(delta))
+	}
+}
+
+func TestSlidingWindowLogBound(t *testing.T) {
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter := NewSlidingWindowLogWithClock(clock)
+	burst := 10
+
+	// 100k calls of ForceN past burst, half of them at the same time as the previous one
+	for i := 0; i < 100000; i++ {
+		if i%2 == 0 {
+			clock.Advance(time.Microsecond)
+		}
+		limiter.ForceN(1, 10, burst)
+	}
+	if len(limiter.entries) > burst {
+		t.Fatalf("expected at most %d entries, got %d", burst, len(limiter.entries))
+	}
+	if limiter.total != 100000 {
+		t.Fatalf("expected the merged entries to keep the 100000 tokens, got %d", limiter.total)
+	}
+	// The merged tokens are held in the window until their entry leaves it, the latest entries are 1µs apart
+	clock.Advance(time.Second - time.Duration(burst)*time.Microsecond)
+	if limiter.AllowN(1, 10, burst) {
+		t.Fatalf("expected denied while the merged tokens are in the window")
+	}
+	clock.Advance(time.Duration(burst) * time.Microsecond)
+	if !limiter.AllowN(burst, 10, burst) {
+		t.Fatalf("expected the burst to be allowed once the forced tokens have left the window")
+	}
+}
+
+func TestFixedWindow(t *testing.T) {
+	replenishPerSecond := 100.0 / 60
+	burst := 100
+
+	t.Run("windows align to calendar minutes", func(t *testing.T) {
+		clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 12, 0, 59, 0, time.UTC))
+		// The window defaults to burst/replenishPerSecond, i.e. a minute
+		limiter := NewFixedWindowWithClock(FixedWindowOption{}, clock)
+		res := limiter.AllowNDetailed(burst, replenishPerSecond, burst)
+		if !res.Allowed || res.Remaining != 0 {
+			t.Fatalf("expected the whole burst to be allowed, got %+v", res)
+		}
+		if want := time.Date(2025, 1, 1, 12, 1, 0, 0, time.UTC); !res.ResetAt.Equal(want) {
+			t.Fatalf("expected reset at %s, got %s", want, res.ResetAt)
+		}
+		if res = limiter.AllowNDetailed(1, replenishPerSecond, burst); res.Allowed || res.RetryAfter != time.Second {
+			t.Fatalf("expected denied with retry after 1s, got %+v", res)
+		}
+		if r := limiter.ReserveN(5, replenishPerSecond, burst); r.Delay() != time.Second {
+			t.Fatalf("expected the reservation to wait for the next minute, got %s", r.Delay())
+		}
+		clock.Advance(time.Second)
+		if limiter.IsReplenished(clock.Now()) {
+			t.Fatalf("expected the reserved tokens to hold the next minute")
+		}
+		if res = limiter.AllowNDetailed(burst-5, replenishPerSecond, burst); !res.Allowed || res.Remaining != 0 {
+			t.Fatalf("expected the rest of the next minute to be allowed, got %+v", res)
+		}
+		clock.Advance(time.Minute)
+		if !limiter.IsReplenished(clock.Now()) {
+			t.Fatalf("expected the limiter to be replenished after the minute")
+		}
+	})
+
+	t.Run("offset shifts the windows", func(t *testing.T) {
+		clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 12, 10, 0, 0, time.UTC))
+		limiter := NewFixedWindowWithClock(FixedWindowOption{Window: time.Hour, Offset: 30 * time.Minute}, clock)
+		res := limiter.AllowNDetailed(burst, replenishPerSecond, burst)
+		if want := time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC); !res.Allowed || !res.ResetAt.Equal(want) {
+			t.Fatalf("expected allowed with reset at %s, got %+v", want, res)
+		}
+		clock.Set(time.Date(2025, 1, 1, 12, 29, 59, 0, time.UTC))
+		if limiter.AllowN(1, replenishPerSecond, burst) {
+			t.Fatalf("expected denied until :30")
+		}
+		clock.Set(time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC))
+		if !limiter.AllowN(burst, replenishPerSecond, burst) {
+			t.Fatalf("expected the burst to be allowed from :30")
+		}
+	})
+
+	t.Run("cancelled reservations give the tokens back", func(t *testing.T) {
+		clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+		limiter := NewFixedWindowWithClock(FixedWindowOption{}, clock)
+		r := limiter.ReserveN(burst, replenishPerSecond, burst)
+		if !r.OK() || r.Delay() != 0 {
+			t.Fatalf("expected reservation to be ok without delay, got ok=%t delay=%s", r.OK(), r.Delay())
+		}
+		r.Cancel()
+		if !limiter.AllowN(burst, replenishPerSecond, burst) {
+			t.Fatalf("expected the cancelled tokens to be allowed")
+		}
+	})
+}
+
+func TestConcurrency(t *testing.T) {
+	c := NewConcurrency()
+	if !c.AcquireN(3, 5) || !c.AcquireN(2, 5) {
+		t.Fatalf("expected 5 slots to be acquired")
+	}
+	if c.AcquireN(1, 5) {
+		t.Fatalf("expected the limit to be enforced")
+	}
+	if c.AcquireN(-100, 5) {
+		t.Fatalf("expected a negative n to be denied")
+	}
+	c.ReleaseN(-100)
+	if c.InFlight() != 5 {
+		t.Fatalf("expected a negative release to take no slots, got %d in flight", c.InFlight())
+	}
+	c.ReleaseN(2)
+	if !c.AcquireN(2, 5) {
+		t.Fatalf("expected the released slots to be acquired")
+	}
+	c.ReleaseN(10)
+	if c.InFlight() != 0 {
+		t.Fatalf("expected no slots in flight, got %d", c.InFlight())
+	}
+}
+
+func TestAIMD(t *testing.T) {
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter := NewAIMD(NewResetbasedLimiterWithClock(clock), AIMDOption{Increase: 2, MinReplenishPerSecond: 3})
+	if !limiter.AllowN(1, 10, 1) || limiter.Rate() != 10 {
+		t.Fatalf("expected the rate to start at the rate of the call, got %f", limiter.Rate())
+	}
+	limiter.OnSuccess()
+	if limiter.Rate() != 10 {
+		t.Fatalf("expected the rate to be capped by the rate of the call, got %f", limiter.Rate())
+	}
+	limiter.OnOverload()
+	if limiter.Rate() != 5 {
+		t.Fatalf("expected the rate to be halved, got %f", limiter.Rate())
+	}
+	// A token takes 200ms at 5 per second
+	clock.Advance(100 * time.Millisecond)
+	if limiter.AllowN(1, 10, 1) {
+		t.Fatalf("expected the decreased rate to be enforced")
+	}
+	clock.Advance(100 * time.Millisecond)
+	if !limiter.AllowN(1, 10, 1) {
+		t.Fatalf("expected a token after 200ms")
+	}
+	limiter.OnSuccess()
+	if limiter.Rate() != 7 {
+		t.Fatalf("expected the rate to increase by 2, got %f", limiter.Rate())
+	}
+	limiter.OnOverload()
+	limiter.OnOverload()
+	if limiter.Rate() != 3 {
+		t.Fatalf("expected the rate to stop at the floor, got %f", limiter.Rate())
+	}
+}
+
+func TestLimit(t *testing.T) {
+	if l := PerMinute(30); l.ReplenishPerSecond != 0.5 || l.Burst != 30 {
+		t.Fatalf("expected 0.5 per second with a burst of 30, got %+v", l)
+	}
+	if l := Every(100 * time.Millisecond).WithBurst(5); l.ReplenishPerSecond != 10 || l.Burst != 5 {
+		t.Fatalf("expected 10 per second with a burst of 5, got %+v", l)
+	}
+	for _, limiterConfig := range limiters {
+		if limiterConfig.window != "" {
+			continue
+		}
+		t.Run(fmt.Sprintf("limiter=%s", limiterConfig.name), func(t *testing.T) {
+			limit := PerHour(2).WithBurst(1)
+			clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+			limiter := limiterConfig.newLimiterFn(limit.ReplenishPerSecond, limit.Burst, clock)
+			if !AllowNLimit(limiter, 1, limit) {
+				t.Fatalf("expected the first token to be allowed")
+			}
+			clock.Advance(29 * time.Minute)
+			if AllowNLimit(limiter, 1, limit) {
+				t.Fatalf("expected a token every 30 minutes")
+			}
+			clock.Advance(time.Minute)
+			if !AllowNLimit(limiter, 1, limit) {
+				t.Fatalf("expected a token after 30 minutes")
+			}
+		})
+	}
+}
+
+func TestReturnN(t *testing.T) {
+	replenishPerSecond := 1.0
+	burst := 10
+	for _, limiterConfig := range limiters {
+		t.Run(fmt.Sprintf("limiter=%s", limiterConfig.name), func(t *testing.T) {
+			clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+			limiter := limiterConfig.newLimiterFn(replenishPerSecond, burst, clock)
+			// Returning tokens to a limiter that was never used does not hold back its burst
+			if err := ReturnN(limiter, 1); err != nil {
+				if errors.Is(err, ErrReturnNotSupported) {
+					t.Skip("returning tokens is not supported")
+				}
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !limiter.AllowN(burst, replenishPerSecond, burst) {
+				t.Fatalf("expected the burst to be allowed")
+			}
+			if err := ReturnN(limiter, 4); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !limiter.AllowN(4, replenishPerSecond, burst) || limiter.AllowN(1, replenishPerSecond, burst) {
+				t.Fatalf("expected exactly the returned tokens to be allowed")
+			}
+			// Returning more than was consumed does not go beyond burst
+			if err := ReturnN(limiter, 100); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !limiter.AllowN(burst, replenishPerSecond, burst) || limiter.AllowN(1, replenishPerSecond, burst) {
+				t.Fatalf("expected exactly the burst to be allowed")
+			}
+			if err := ReturnN(limiter, -1); !errors.Is(err, ErrNegativeCost) {
+				t.Fatalf("expected ErrNegativeCost, got %v", err)
+			}
+		})
+	}
+}
+
+func FuzzLimiter(f *testing.F) {
+	f.Add(1, 10.0, 10, uint8(20))
+	f.Add(-1, 10.0, 10, uint8(1))
+	f.Add(1, 0.0, 10, uint8(1))
+	f.Add(1, -1.0, 10, uint8(1))
+	f.Add(1, 10.0, -1, uint8(1))
+	f.Add(0, 0.001, 0, uint8(5))
+	f.Add(3, 1e6, 1000000, uint8(50))
+	f.Fuzz(func(t *testing.T, n int, replenishPerSecond float64, burst int, calls uint8) {
+		invalid := Validate(n, replenishPerSecond, burst) != nil
+		// Keep the valid calls in a range where the limiters neither round the rate down to nothing nor overflow
+		if !invalid && (replenishPerSecond < 1e-3 || replenishPerSecond > 1e6 || burst > 1e6 || n > 1e6) {
+			t.Skip()
+		}
+		for _, limiterConfig := range limiters {
+			clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+			limiter := limiterConfig.newLimiterFn(replenishPerSecond, burst, clock)
+			allowed := 0
+			for range calls {
+				if limiter.AllowN(n, replenishPerSecond, burst) {
+					if invalid {
+						t.Fatalf("%s: invalid call n=%d rate=%f burst=%d was allowed", limiterConfig.name, n, replenishPerSecond, burst)
+					}
+					allowed += n
+				}
+			}
+			// The clock does not move, so no more than burst tokens are ever allowed
+			if allowed > max(burst, 0) {
+				t.Fatalf("%s: allowed %d tokens with a burst of %d", limiterConfig.name, allowed, burst)
+			}
+			r := limiter.ReserveN(n, replenishPerSecond, burst)
+			if invalid && r.OK() {
+				t.Fatalf("%s: invalid reservation n=%d rate=%f burst=%d is ok", limiterConfig.name, n, replenishPerSecond, burst)
+			}
+			r.Cancel()
+			res := AllowNDetailed(limiter, n, replenishPerSecond, burst)
+			if invalid && (res.Allowed || res.RetryAfter != -1) {
+				t.Fatalf("%s: invalid call n=%d rate=%f burst=%d got %+v", limiterConfig.name, n, replenishPerSecond, burst, res)
+			}
+			if res.Remaining < 0 || !invalid && res.Remaining > burst {
+				t.Fatalf("%s: remaining %d out of [0, %d]", limiterConfig.name, res.Remaining, burst)
+			}
+		}
+	})
+}
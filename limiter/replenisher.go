@@ -0,0 +1,10 @@
+package limiter
+
+import "time"
+
+// Replenisher is implemented by limiters that can tell whether they are back to full burst.
+// A replenished limiter behaves the same as a new one, so it can be dropped and recreated without changing any decision.
+// The rate and burst of the latest call are used for the check.
+type Replenisher interface {
+	IsReplenished(time.Time) bool
+}
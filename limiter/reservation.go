@@ -0,0 +1,70 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// InfDuration is the duration returned by Delay when a Reservation is not OK.
+const InfDuration = time.Duration(math.MaxInt64)
+
+// Reservation holds information about events that are permitted by a Limiter to happen after a delay.
+// It follows the naming of `golang.org/x/time/rate.Reservation`.
+type Reservation struct {
+	ok        bool
+	clock     Clock
+	timeToAct time.Time
+	cancel    func()
+	once      sync.Once
+}
+
+func newReservation(clock Clock, timeToAct time.Time, cancel func()) *Reservation {
+	return &Reservation{
+		ok:        true,
+		clock:     clock,
+		timeToAct: timeToAct,
+		cancel:    cancel,
+	}
+}
+
+// OK returns whether the limiter can provide the requested number of tokens.
+// If OK is false, Delay returns InfDuration, and Cancel does nothing.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// TimeToAct returns the time at which the reserved action may be performed.
+// It returns the zero time if the reservation is not OK.
+func (r *Reservation) TimeToAct() time.Time {
+	return r.timeToAct
+}
+
+// Delay is shorthand for DelayFrom with the current time of the limiter's clock.
+func (r *Reservation) Delay() time.Duration {
+	return r.DelayFrom(orSystemClock(r.clock).Now())
+}
+
+// DelayFrom returns the duration for which the reservation holder must wait before taking the reserved action.
+// Zero duration means act immediately, InfDuration means the reservation is not OK.
+func (r *Reservation) DelayFrom(t time.Time) time.Duration {
+	if !r.ok {
+		return InfDuration
+	}
+	delay := r.timeToAct.Sub(t)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// Cancel indicates that the reservation holder will not perform the reserved action
+// and gives the reserved tokens back to the limiter, as far as the limiter can tell that no later reservation waits for them,
+// see `rate.Reservation.CancelAt`.
+// Calling Cancel more than once has no further effect.
+func (r *Reservation) Cancel() {
+	if !r.ok || r.cancel == nil {
+		return
+	}
+	r.once.Do(r.cancel)
+}
@@ -10,17 +10,43 @@ type ResetBasedLimiter struct {
 	resetAt           atomic.Int64
 	mu                sync.RWMutex
 	deltaSinceLastPop atomic.Int64
+	// burstInNano of the latest call, used to tell whether the limiter is replenished
+	burstInNano atomic.Int64
+	// nanosecondsPerToken of the latest call, used to give tokens back
+	nanosecondsPerToken atomic.Int64
+	// lastEvent is the time to act of the latest consumption, guarded by mu, see ReserveN
+	lastEvent int64
+	clock     Clock
 }
 
-var _ Limiter = &ResetBasedLimiter{}
+var _ DetailedLimiter = &ResetBasedLimiter{}
+var _ Replenisher = &ResetBasedLimiter{}
+var _ SyncableLimiter = &ResetBasedLimiter{}
+var _ Returner = &ResetBasedLimiter{}
 
 func NewResetbasedLimiter() *ResetBasedLimiter {
 	l := &ResetBasedLimiter{}
 	return l
 }
 
+// NewResetbasedLimiterWithClock is NewResetbasedLimiter with time read from clock
+func NewResetbasedLimiterWithClock(clock Clock) *ResetBasedLimiter {
+	l := &ResetBasedLimiter{clock: clock}
+	return l
+}
+
+func (l *ResetBasedLimiter) now() int64 {
+	if l.clock == nil {
+		return time.Now().UnixNano()
+	}
+	return l.clock.Now().UnixNano()
+}
+
 func (l *ResetBasedLimiter) allowN(n int, replenishPerSecond float64, burst int, shouldCheck bool) bool {
-	now := time.Now().UnixNano()
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return false
+	}
+	now := l.now()
 	if shouldCheck && (l.resetAt.Load() > now || n > burst) {
 		return false
 	}
@@ -37,6 +63,9 @@ func (l *ResetBasedLimiter) allowN(n int, replenishPerSecond float64, burst int,
 		return false
 	}
 	l.resetAt.Store(newResetAt)
+	l.burstInNano.Store(burstInNano)
+	l.nanosecondsPerToken.Store(nanosecondsPerToken)
+	l.lastEvent = max(newResetAt, now)
 	l.AddDeltaSinceLastPop(incrementInNano)
 	return true
 }
@@ -64,3 +93,98 @@ func (l *ResetBasedLimiter) PopResetAtDelta() int64 {
 func (l *ResetBasedLimiter) AddDeltaSinceLastPop(delta int64) {
 	l.deltaSinceLastPop.Add(delta)
 }
+
+// ReturnN moves resetAt back by n tokens of the latest call, it is never moved back further than a burst before now.
+// The negative delta is synced like any other consumption, see SyncableLimiter.
+func (l *ResetBasedLimiter) ReturnN(n int) {
+	if n <= 0 {
+		return
+	}
+	now := l.now()
+	decrementInNano := int64(n) * l.nanosecondsPerToken.Load()
+	l.mu.Lock()
+	resetAt := l.resetAt.Load()
+	newResetAt := max(resetAt-decrementInNano, min(now-l.burstInNano.Load(), resetAt))
+	l.resetAt.Store(newResetAt)
+	l.mu.Unlock()
+	l.AddDeltaSinceLastPop(newResetAt - resetAt)
+}
+
+// ReserveN consumes n tokens regardless of the current state and returns when they may be used.
+// Cancelling the reservation moves resetAt back by the reserved tokens that no later consumption waits for, like `rate.Reservation.CancelAt`.
+func (l *ResetBasedLimiter) ReserveN(n int, replenishPerSecond float64, burst int) *Reservation {
+	if n > burst || Validate(n, replenishPerSecond, burst) != nil {
+		return &Reservation{}
+	}
+	now := l.now()
+	nanosecondsPerToken := int64(float64(time.Second) / replenishPerSecond)
+	burstInNano := int64(burst) * nanosecondsPerToken
+	incrementInNano := int64(n) * nanosecondsPerToken
+
+	l.mu.Lock()
+	newResetAt := max(now-burstInNano, l.resetAt.Load()) + incrementInNano
+	l.resetAt.Store(newResetAt)
+	l.burstInNano.Store(burstInNano)
+	l.nanosecondsPerToken.Store(nanosecondsPerToken)
+	timeToAct := max(newResetAt, now)
+	l.lastEvent = timeToAct
+	l.mu.Unlock()
+	l.AddDeltaSinceLastPop(incrementInNano)
+
+	return newReservation(l.clock, time.Unix(0, timeToAct), func() {
+		l.mu.Lock()
+		// The later consumptions wait for the tokens replenished between this time to act and theirs
+		restore := incrementInNano - (l.lastEvent - timeToAct)
+		if restore <= 0 {
+			l.mu.Unlock()
+			return
+		}
+		l.resetAt.Add(-restore)
+		if l.lastEvent == timeToAct {
+			l.lastEvent = timeToAct - incrementInNano
+		}
+		l.mu.Unlock()
+		l.AddDeltaSinceLastPop(-restore)
+	})
+}
+
+// AllowNDetailed is AllowN that also reports the remaining tokens and the reset time derived from resetAt
+func (l *ResetBasedLimiter) AllowNDetailed(n int, replenishPerSecond float64, burst int) Result {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return Result{RetryAfter: -1}
+	}
+	now := l.now()
+	nanosecondsPerToken := int64(float64(time.Second) / replenishPerSecond)
+	burstInNano := int64(burst) * nanosecondsPerToken
+	incrementInNano := int64(n) * nanosecondsPerToken
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	resetAt := max(now-burstInNano, l.resetAt.Load())
+	newResetAt := resetAt + incrementInNano
+	res := Result{}
+	switch {
+	case n > burst:
+		res.RetryAfter = -1
+	case newResetAt > now:
+		res.RetryAfter = time.Duration(newResetAt - now)
+	default:
+		l.resetAt.Store(newResetAt)
+		l.burstInNano.Store(burstInNano)
+		l.nanosecondsPerToken.Store(nanosecondsPerToken)
+		l.lastEvent = max(newResetAt, now)
+		l.AddDeltaSinceLastPop(incrementInNano)
+		resetAt = newResetAt
+		res.Allowed = true
+	}
+	if nanosecondsPerToken > 0 {
+		res.Remaining = int(max(now-resetAt, 0) / nanosecondsPerToken)
+	}
+	res.ResetAt = time.Unix(0, max(resetAt+burstInNano, now))
+	return res
+}
+
+// IsReplenished reports whether resetAt is at least a burst behind t
+func (l *ResetBasedLimiter) IsReplenished(t time.Time) bool {
+	return l.resetAt.Load()+l.burstInNano.Load() <= t.UnixNano()
+}
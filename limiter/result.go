@@ -0,0 +1,32 @@
+package limiter
+
+import "time"
+
+// Result is the detailed outcome of an AllowNDetailed call.
+// It carries enough information to fill headers such as `Retry-After` and `X-RateLimit-Remaining`.
+type Result struct {
+	// Allowed is whether the tokens were consumed
+	Allowed bool
+	// Remaining is the number of whole tokens left after this call
+	Remaining int
+	// ResetAt is the time at which the limiter is fully replenished
+	ResetAt time.Time
+	// RetryAfter is how long to wait until n tokens are available.
+	// It is zero if the call is allowed and -1 if n can never be allowed, e.g. n exceeds burst.
+	RetryAfter time.Duration
+}
+
+// DetailedLimiter is a Limiter that can report the state of the limiter alongside the decision
+type DetailedLimiter interface {
+	Limiter
+	AllowNDetailed(int, float64, int) Result
+}
+
+// AllowNDetailed calls `AllowNDetailed` if l implements DetailedLimiter.
+// Otherwise it falls back to `AllowN` and only Allowed is set.
+func AllowNDetailed(l Limiter, n int, replenishPerSecond float64, burst int) Result {
+	if dl, ok := l.(DetailedLimiter); ok {
+		return dl.AllowNDetailed(n, replenishPerSecond, burst)
+	}
+	return Result{Allowed: l.AllowN(n, replenishPerSecond, burst)}
+}
@@ -0,0 +1,20 @@
+package limiter
+
+// Returner is implemented by limiters that can give consumed tokens back, e.g. when the work they paid for failed before doing anything.
+// The tokens are returned against the rate and burst of the latest call, a limiter never holds more than burst tokens after a return.
+type Returner interface {
+	ReturnN(int)
+}
+
+// ReturnN gives n tokens back to l if it implements Returner, it returns `ErrReturnNotSupported` otherwise
+func ReturnN(l Limiter, n int) error {
+	if n < 0 {
+		return ErrNegativeCost
+	}
+	r, ok := l.(Returner)
+	if !ok {
+		return ErrReturnNotSupported
+	}
+	r.ReturnN(n)
+	return nil
+}
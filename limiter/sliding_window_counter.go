@@ -0,0 +1,279 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SlidingWindowCounter approximates a sliding window of burst/replenishPerSecond with two fixed windows:
+// the count of the previous window, weighted by the part of it still covered by the sliding window, plus the count of the current window.
+// It only keeps a few counters per limiter. The windows are aligned to multiples of their length since the Unix epoch, like FixedWindow,
+// so the limiters of every key and of every instance roll their windows at the same time.
+type SlidingWindowCounter struct {
+	mu sync.Mutex
+	// start of the current window in nanoseconds
+	start  int64
+	window int64
+	prev   float64
+	curr   float64
+	// next counts the tokens reserved for the next window
+	next float64
+	// resetAt accounts the consumed tokens in nanoseconds, GCRA style, so that the limiter can be synced, see SyncableLimiter
+	resetAt           int64
+	deltaSinceLastPop atomic.Int64
+	// unconverted holds the nanoseconds synced before the first call, when the rate is not known yet
+	unconverted         int64
+	nanosecondsPerToken int64
+	clock               Clock
+}
+
+var _ DetailedLimiter = &SlidingWindowCounter{}
+var _ Replenisher = &SlidingWindowCounter{}
+var _ SyncableLimiter = &SlidingWindowCounter{}
+var _ Returner = &SlidingWindowCounter{}
+
+func NewSlidingWindowCounter() *SlidingWindowCounter {
+	return NewSlidingWindowCounterWithClock(SystemClock)
+}
+
+// NewSlidingWindowCounterWithClock is NewSlidingWindowCounter with time read from clock
+func NewSlidingWindowCounterWithClock(clock Clock) *SlidingWindowCounter {
+	return &SlidingWindowCounter{clock: orSystemClock(clock)}
+}
+
+func (l *SlidingWindowCounter) now() int64 {
+	return orSystemClock(l.clock).Now().UnixNano()
+}
+
+func (l *SlidingWindowCounter) AllowN(n int, replenishPerSecond float64, burst int) bool {
+	return l.allowN(n, replenishPerSecond, burst, true)
+}
+
+func (l *SlidingWindowCounter) ForceN(n int, replenishPerSecond float64, burst int) bool {
+	return l.allowN(n, replenishPerSecond, burst, false)
+}
+
+func (l *SlidingWindowCounter) allowN(n int, replenishPerSecond float64, burst int, shouldCheck bool) bool {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return false
+	}
+	if shouldCheck && n > burst {
+		return false
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now, replenishPerSecond, burst)
+	if shouldCheck && l.estimate(now)+float64(n) > float64(burst) {
+		return false
+	}
+	l.curr += float64(n)
+	l.account(now, n)
+	return true
+}
+
+// ReserveN counts the tokens in the window in which the estimate leaves room for them.
+// Tokens reserved beyond the next window are counted in the next window.
+// Cancelling the reservation removes the tokens from their window, and gives them back to resetAt, if the window is still tracked.
+func (l *SlidingWindowCounter) ReserveN(n int, replenishPerSecond float64, burst int) *Reservation {
+	if n > burst || Validate(n, replenishPerSecond, burst) != nil {
+		return &Reservation{}
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now, replenishPerSecond, burst)
+	timeToAct := l.availableAt(now, n, burst)
+	windowStart := l.start
+	if timeToAct < l.start+l.window {
+		l.curr += float64(n)
+	} else {
+		windowStart += l.window
+		l.next += float64(n)
+	}
+	incrementInNano := l.account(now, n)
+	return newReservation(l.clock, time.Unix(0, timeToAct), func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.roll(l.now())
+		switch windowStart {
+		case l.start - l.window:
+			l.prev = max(l.prev-float64(n), 0)
+		case l.start:
+			l.curr = max(l.curr-float64(n), 0)
+		case l.start + l.window:
+			l.next = max(l.next-float64(n), 0)
+		default:
+			// The window has left the sliding window, its tokens are replenished already
+			return
+		}
+		l.resetAt -= incrementInNano
+		l.AddDeltaSinceLastPop(-incrementInNano)
+	})
+}
+
+// AllowNDetailed is AllowN that also reports the room left by the estimate and when both windows are empty
+func (l *SlidingWindowCounter) AllowNDetailed(n int, replenishPerSecond float64, burst int) Result {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return Result{RetryAfter: -1}
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now, replenishPerSecond, burst)
+	res := Result{}
+	switch {
+	case n > burst:
+		res.RetryAfter = -1
+	case l.estimate(now)+float64(n) > float64(burst):
+		res.RetryAfter = time.Duration(l.availableAt(now, n, burst) - now)
+	default:
+		l.curr += float64(n)
+		l.account(now, n)
+		res.Allowed = true
+	}
+	res.Remaining = max(int(float64(burst)-l.estimate(now)), 0)
+	res.ResetAt = time.Unix(0, max(l.drainedAt(), now))
+	return res
+}
+
+// ReturnN removes n tokens from the current window and moves resetAt back by as many tokens as were removed
+func (l *SlidingWindowCounter) ReturnN(n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.roll(l.now())
+	returned := min(float64(n), l.curr)
+	l.curr -= returned
+	decrementInNano := int64(returned * float64(l.nanosecondsPerToken))
+	l.resetAt -= decrementInNano
+	l.AddDeltaSinceLastPop(-decrementInNano)
+}
+
+// IsReplenished reports whether both windows are empty at t
+func (l *SlidingWindowCounter) IsReplenished(t time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.drainedAt() <= t.UnixNano()
+}
+
+func (l *SlidingWindowCounter) GetResetAt() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.resetAt
+}
+
+// IncrementResetAtBy counts the tokens consumed elsewhere in the current window
+func (l *SlidingWindowCounter) IncrementResetAtBy(inc int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resetAt += inc
+	if l.nanosecondsPerToken <= 0 {
+		l.unconverted += inc
+		return
+	}
+	l.curr = max(l.curr+float64(inc)/float64(l.nanosecondsPerToken), 0)
+}
+
+func (l *SlidingWindowCounter) PopResetAtDelta() int64 {
+	return l.deltaSinceLastPop.Swap(0)
+}
+
+func (l *SlidingWindowCounter) AddDeltaSinceLastPop(delta int64) {
+	l.deltaSinceLastPop.Add(delta)
+}
+
+// advance picks up the window of the rate and burst of the call and moves the windows up to now
+func (l *SlidingWindowCounter) advance(now int64, replenishPerSecond float64, burst int) {
+	l.nanosecondsPerToken = int64(float64(time.Second) / replenishPerSecond)
+	window := int64(burst) * l.nanosecondsPerToken
+	if window <= 0 {
+		l.start, l.window = now, 0
+		l.prev, l.curr, l.next = 0, 0, 0
+		return
+	}
+	if window != l.window {
+		// Align the windows at the first call, or re-align them when the limit changes
+		elapsed := now % window
+		// The remainder is negative before the epoch, keep the window start at or before now
+		if elapsed < 0 {
+			elapsed += window
+		}
+		l.start, l.window = now-elapsed, window
+	} else {
+		l.roll(now)
+	}
+	if l.unconverted != 0 {
+		l.curr = max(l.curr+float64(l.unconverted)/float64(l.nanosecondsPerToken), 0)
+		l.unconverted = 0
+	}
+}
+
+// roll shifts the counters by the number of windows elapsed since the current window started
+func (l *SlidingWindowCounter) roll(now int64) {
+	if l.window <= 0 || now < l.start+l.window {
+		return
+	}
+	elapsed := (now - l.start) / l.window
+	switch elapsed {
+	case 1:
+		l.prev, l.curr, l.next = l.curr, l.next, 0
+	case 2:
+		l.prev, l.curr, l.next = l.next, 0, 0
+	default:
+		l.prev, l.curr, l.next = 0, 0, 0
+	}
+	l.start += elapsed * l.window
+}
+
+// estimate is the weighted count of the sliding window ending at now, reserved tokens count right away
+func (l *SlidingWindowCounter) estimate(now int64) float64 {
+	if l.window <= 0 {
+		return 0
+	}
+	overlap := 1 - float64(now-l.start)/float64(l.window)
+	return l.prev*overlap + l.curr + l.next
+}
+
+// availableAt returns the earliest time at which the estimate leaves room for n more tokens
+func (l *SlidingWindowCounter) availableAt(now int64, n int, burst int) int64 {
+	// The weighted and the fully counted tokens of the current, next and following windows
+	windows := [3][2]float64{{l.prev, l.curr + l.next}, {l.curr, l.next}, {l.next, 0}}
+	for i, w := range windows {
+		start := l.start + int64(i)*l.window
+		room := float64(burst-n) - w[1]
+		if room < 0 {
+			continue
+		}
+		if w[0] <= room {
+			return max(start, now)
+		}
+		return max(start+int64(math.Ceil((1-room/w[0])*float64(l.window))), now)
+	}
+	return max(l.start+3*l.window, now)
+}
+
+// drainedAt returns when the weighted count of the windows drops to zero
+func (l *SlidingWindowCounter) drainedAt() int64 {
+	switch {
+	case l.next > 0:
+		return l.start + 3*l.window
+	case l.curr > 0:
+		return l.start + 2*l.window
+	case l.prev > 0:
+		return l.start + l.window
+	}
+	return l.start
+}
+
+// account moves resetAt the way ResetBasedLimiter does, it returns the increment in nanoseconds
+func (l *SlidingWindowCounter) account(now int64, n int) int64 {
+	incrementInNano := int64(n) * l.nanosecondsPerToken
+	l.resetAt = max(now-l.window, l.resetAt) + incrementInNano
+	l.AddDeltaSinceLastPop(incrementInNano)
+	return incrementInNano
+}
@@ -0,0 +1,200 @@
+package limiter
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SlidingWindowLog allows at most burst tokens in any rolling window of burst/replenishPerSecond.
+// It keeps a log of the calls inside the window, one entry per call, with the calls at the same time merged into one entry.
+// The memory is bounded by burst entries, past which the oldest entries are merged into the next ones, e.g. on calls of ForceN beyond burst.
+type SlidingWindowLog struct {
+	mu      sync.Mutex
+	entries []logEntry
+	total   int
+	// window of the latest call, used to tell whether the limiter is replenished
+	window int64
+	clock  Clock
+}
+
+type logEntry struct {
+	at int64
+	n  int
+}
+
+var _ DetailedLimiter = &SlidingWindowLog{}
+var _ Replenisher = &SlidingWindowLog{}
+var _ Returner = &SlidingWindowLog{}
+
+func NewSlidingWindowLog() *SlidingWindowLog {
+	return NewSlidingWindowLogWithClock(SystemClock)
+}
+
+// NewSlidingWindowLogWithClock is NewSlidingWindowLog with time read from clock
+func NewSlidingWindowLogWithClock(clock Clock) *SlidingWindowLog {
+	return &SlidingWindowLog{clock: orSystemClock(clock)}
+}
+
+func (l *SlidingWindowLog) now() int64 {
+	return orSystemClock(l.clock).Now().UnixNano()
+}
+
+func (l *SlidingWindowLog) AllowN(n int, replenishPerSecond float64, burst int) bool {
+	return l.allowN(n, replenishPerSecond, burst, true)
+}
+
+func (l *SlidingWindowLog) ForceN(n int, replenishPerSecond float64, burst int) bool {
+	return l.allowN(n, replenishPerSecond, burst, false)
+}
+
+func (l *SlidingWindowLog) allowN(n int, replenishPerSecond float64, burst int, shouldCheck bool) bool {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return false
+	}
+	if shouldCheck && n > burst {
+		return false
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.evict(now, replenishPerSecond, burst)
+	if shouldCheck && l.total+n > burst {
+		return false
+	}
+	l.insert(logEntry{at: now, n: n}, burst)
+	return true
+}
+
+// ReserveN logs the tokens at the time the oldest entries leave the window and frees enough room.
+// Cancelling the reservation removes its tokens from the log.
+func (l *SlidingWindowLog) ReserveN(n int, replenishPerSecond float64, burst int) *Reservation {
+	if n > burst || Validate(n, replenishPerSecond, burst) != nil {
+		return &Reservation{}
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.evict(now, replenishPerSecond, burst)
+	e := logEntry{at: l.availableAt(now, n, burst), n: n}
+	l.insert(e, burst)
+	return newReservation(l.clock, time.Unix(0, e.at), func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.remove(e)
+	})
+}
+
+// AllowNDetailed is AllowN that also reports the room left in the window and when the log empties
+func (l *SlidingWindowLog) AllowNDetailed(n int, replenishPerSecond float64, burst int) Result {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return Result{RetryAfter: -1}
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.evict(now, replenishPerSecond, burst)
+	res := Result{}
+	switch {
+	case n > burst:
+		res.RetryAfter = -1
+	case l.total+n > burst:
+		res.RetryAfter = time.Duration(l.availableAt(now, n, burst) - now)
+	default:
+		l.insert(logEntry{at: now, n: n}, burst)
+		res.Allowed = true
+	}
+	res.Remaining = max(burst-l.total, 0)
+	res.ResetAt = time.Unix(0, now)
+	if len(l.entries) > 0 {
+		res.ResetAt = time.Unix(0, max(l.entries[len(l.entries)-1].at+l.window, now))
+	}
+	return res
+}
+
+// ReturnN removes n tokens from the newest entries of the log
+func (l *SlidingWindowLog) ReturnN(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.entries) - 1; n > 0 && i >= 0; i-- {
+		returned := min(l.entries[i].n, n)
+		l.entries[i].n -= returned
+		l.total -= returned
+		n -= returned
+		if l.entries[i].n == 0 {
+			l.entries = append(l.entries[:i], l.entries[i+1:]...)
+		}
+	}
+}
+
+// IsReplenished reports whether every entry of the log has left the window at t
+func (l *SlidingWindowLog) IsReplenished(t time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries) == 0 || l.entries[len(l.entries)-1].at+l.window <= t.UnixNano()
+}
+
+// evict drops the entries that have left the window ending at now
+func (l *SlidingWindowLog) evict(now int64, replenishPerSecond float64, burst int) {
+	l.window = int64(float64(burst) / replenishPerSecond * float64(time.Second))
+	i := 0
+	for ; i < len(l.entries) && l.entries[i].at+l.window <= now; i++ {
+		l.total -= l.entries[i].n
+	}
+	if i == len(l.entries) {
+		// Reuse the backing array when the log is emptied
+		l.entries = l.entries[:0]
+	} else {
+		l.entries = l.entries[i:]
+	}
+}
+
+// availableAt returns the earliest time at which n more tokens fit in the window
+func (l *SlidingWindowLog) availableAt(now int64, n int, burst int) int64 {
+	excess := l.total + n - burst
+	for i := 0; excess > 0 && i < len(l.entries); i++ {
+		excess -= l.entries[i].n
+		if excess <= 0 {
+			return max(l.entries[i].at+l.window, now)
+		}
+	}
+	return now
+}
+
+// insert keeps the log sorted, entries of reservations may be in the future.
+// An entry at the time of another is merged into it, and past burst entries the oldest entry is merged into the next one,
+// which holds its tokens in the window a little longer than they should but never lets more than burst tokens in.
+func (l *SlidingWindowLog) insert(e logEntry, burst int) {
+	if e.n <= 0 {
+		return
+	}
+	l.total += e.n
+	i := sort.Search(len(l.entries), func(i int) bool { return l.entries[i].at > e.at })
+	switch {
+	case i > 0 && l.entries[i-1].at == e.at:
+		l.entries[i-1].n += e.n
+	case i == len(l.entries):
+		l.entries = append(l.entries, e)
+	default:
+		l.entries = append(l.entries, logEntry{})
+		copy(l.entries[i+1:], l.entries[i:])
+		l.entries[i] = e
+	}
+	for len(l.entries) > max(burst, 1) {
+		l.entries[1].n += l.entries[0].n
+		l.entries = l.entries[1:]
+	}
+}
+
+// remove takes the tokens of e out of the entry it was logged in or merged into, the first entry from the time of e
+func (l *SlidingWindowLog) remove(e logEntry) {
+	i := sort.Search(len(l.entries), func(i int) bool { return l.entries[i].at >= e.at })
+	if i == len(l.entries) || l.entries[i].n < e.n {
+		return
+	}
+	l.entries[i].n -= e.n
+	l.total -= e.n
+	if l.entries[i].n == 0 {
+		l.entries = append(l.entries[:i], l.entries[i+1:]...)
+	}
+}
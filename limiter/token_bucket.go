@@ -6,21 +6,39 @@ import (
 	"time"
 )
 
+var _ DetailedLimiter = &Bucket{}
+var _ Replenisher = &Bucket{}
+var _ Returner = &Bucket{}
+
 type Bucket struct {
 	B         float64
 	R         float64
 	remaining float64
 	lastCheck time.Time
+	// lastEvent is the time to act of the latest consumption, see ReserveN
+	lastEvent time.Time
 	mu        sync.Mutex
+	clock     Clock
 }
 
 func NewBucket() *Bucket {
+	return NewBucketWithClock(SystemClock)
+}
+
+// NewBucketWithClock is NewBucket with time read from clock
+func NewBucketWithClock(clock Clock) *Bucket {
+	clock = orSystemClock(clock)
 	return &Bucket{
 		remaining: math.MaxFloat64,
-		lastCheck: time.Now(),
+		lastCheck: clock.Now(),
+		clock:     clock,
 	}
 }
 
+func (b *Bucket) now() time.Time {
+	return orSystemClock(b.clock).Now()
+}
+
 func (b *Bucket) ForceN(n int, replenishPerSecond float64, burst int) bool {
 	return b.allowN(n, replenishPerSecond, burst, false)
 }
@@ -30,24 +48,126 @@ func (b *Bucket) AllowN(n int, replenishPerSecond float64, burst int) bool {
 }
 
 func (b *Bucket) allowN(n int, replenishPerSecond float64, burst int, shouldCheck bool) bool {
-	now := time.Now()
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return false
+	}
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now, replenishPerSecond, burst)
+	nFloat := float64(n)
+	if !shouldCheck || b.remaining >= nFloat {
+		b.remaining -= nFloat
+		b.event(now, replenishPerSecond)
+		return true
+	} else {
+		return false
+	}
+}
+
+// ReserveN consumes n tokens, letting remaining go negative, and returns when the deficit is replenished.
+// Cancelling the reservation adds back the tokens that no later consumption waits for, capped at burst, like `rate.Reservation.CancelAt`.
+func (b *Bucket) ReserveN(n int, replenishPerSecond float64, burst int) *Reservation {
+	if n > burst || Validate(n, replenishPerSecond, burst) != nil {
+		return &Reservation{}
+	}
+	now := b.now()
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	b.refill(now, replenishPerSecond, burst)
+	nFloat := float64(n)
+	b.remaining -= nFloat
+	timeToAct := b.event(now, replenishPerSecond)
+	return newReservation(b.clock, timeToAct, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// The later consumptions wait for the tokens replenished between this time to act and theirs
+		restore := nFloat - b.lastEvent.Sub(timeToAct).Seconds()*replenishPerSecond
+		if restore <= 0 {
+			return
+		}
+		b.remaining = min(b.remaining+restore, float64(burst))
+		if b.lastEvent.Equal(timeToAct) {
+			b.lastEvent = timeToAct.Add(-secondsToDuration(nFloat / replenishPerSecond))
+		}
+	})
+}
+
+// ReturnN adds n tokens back to remaining, capped at the burst of the latest call.
+// A bucket that was never used is full, returning tokens to it has no effect.
+func (b *Bucket) ReturnN(n int) {
+	if n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// The rate is only known from the first call on, until then the burst is not known either
+	if b.R == 0 {
+		return
+	}
+	b.remaining = min(b.remaining+float64(n), b.B)
+}
+
+// IsReplenished reports whether remaining has leaked back to B at t
+func (b *Bucket) IsReplenished(t time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remaining+t.Sub(b.lastCheck).Seconds()*b.R >= b.B
+}
+
+func (b *Bucket) refill(now time.Time, replenishPerSecond float64, burst int) {
+	b.B = float64(burst)
+	b.R = replenishPerSecond
 	leak := now.Sub(b.lastCheck).Seconds() * replenishPerSecond
 
 	if leak > 0 {
-		if b.remaining+leak > float64(burst) {
-			b.remaining = float64(burst)
-		} else {
-			b.remaining += leak
-		}
+		b.remaining += leak
 		b.lastCheck = now
 	}
+	// Capping outside of the leak also covers a new bucket used at the same instant it is created
+	if b.remaining > float64(burst) {
+		b.remaining = float64(burst)
+	}
+}
+
+// AllowNDetailed is AllowN that also reports the remaining tokens and the reset time derived from remaining
+func (b *Bucket) AllowNDetailed(n int, replenishPerSecond float64, burst int) Result {
+	if Validate(n, replenishPerSecond, burst) != nil {
+		return Result{RetryAfter: -1}
+	}
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now, replenishPerSecond, burst)
 	nFloat := float64(n)
-	if !shouldCheck || b.remaining >= nFloat {
+	res := Result{}
+	switch {
+	case n > burst || replenishPerSecond <= 0 && b.remaining < nFloat:
+		res.RetryAfter = -1
+	case b.remaining < nFloat:
+		res.RetryAfter = secondsToDuration((nFloat - b.remaining) / replenishPerSecond)
+	default:
 		b.remaining -= nFloat
-		return true
-	} else {
-		return false
+		b.event(now, replenishPerSecond)
+		res.Allowed = true
 	}
+	res.Remaining = int(max(b.remaining, 0))
+	res.ResetAt = now
+	if replenishPerSecond > 0 && b.remaining < float64(burst) {
+		res.ResetAt = now.Add(secondsToDuration((float64(burst) - b.remaining) / replenishPerSecond))
+	}
+	return res
+}
+
+// event records the time to act of a consumption, when remaining is no longer negative
+func (b *Bucket) event(now time.Time, replenishPerSecond float64) time.Time {
+	b.lastEvent = now
+	if b.remaining < 0 {
+		b.lastEvent = now.Add(secondsToDuration(-b.remaining / replenishPerSecond))
+	}
+	return b.lastEvent
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
 }
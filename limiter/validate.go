@@ -0,0 +1,21 @@
+package limiter
+
+import (
+	"fmt"
+	"math"
+)
+
+// Validate returns an error wrapping ErrNegativeCost, ErrInvalidRate or ErrInvalidBurst if the arguments of a call are invalid.
+// The limiters deny invalid calls, the keyed ratelimiters return the error.
+// An infinite rate is valid, it allows every call within burst.
+func Validate(n int, replenishPerSecond float64, burst int) error {
+	switch {
+	case n < 0:
+		return fmt.Errorf("%w: n=%d", ErrNegativeCost, n)
+	case math.IsNaN(replenishPerSecond) || replenishPerSecond <= 0:
+		return fmt.Errorf("%w: replenishPerSecond=%f", ErrInvalidRate, replenishPerSecond)
+	case burst < 0:
+		return fmt.Errorf("%w: burst=%d", ErrInvalidBurst, burst)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WaitN blocks until l permits n events to happen.
+// It returns an error if n exceeds burst, the context is canceled, or the expected wait time exceeds the context deadline.
+// In the error cases no tokens are consumed.
+func WaitN(ctx context.Context, l Limiter, n int, replenishPerSecond float64, burst int) error {
+	if err := Validate(n, replenishPerSecond, burst); err != nil {
+		return err
+	}
+	if n > burst {
+		return fmt.Errorf("%w: WaitN(n=%d) burst=%d", ErrExceedsBurst, n, burst)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	r := l.ReserveN(n, replenishPerSecond, burst)
+	if !r.OK() {
+		return fmt.Errorf("limiter: WaitN(n=%d) cannot be satisfied with rate=%f burst=%d", n, replenishPerSecond, burst)
+	}
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(time.Now().Add(delay)) {
+		r.Cancel()
+		return fmt.Errorf("%w: WaitN(n=%d) delay=%s", ErrWaitExceedsDeadline, n, delay)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the tokens back so that other events may proceed sooner
+		r.Cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+)
+
+// aimdRatelimiter is a keyed ratelimiter holding a `limiter.AIMD` per key, e.g. `Sharded[*limiter.AIMD]`
+type aimdRatelimiter interface {
+	Ratelimiter
+	GetLimiter(string) *limiter.AIMD
+}
+
+// Adaptive is a keyed ratelimiter whose keys adapt their rate to the feedback of the callers, see `limiter.AIMD`.
+// The adaptive state lives in the limiters of the wrapped keyed ratelimiter, so it follows the eviction of the keys.
+type Adaptive[R aimdRatelimiter] struct {
+	inner R
+}
+
+var _ AdaptiveRatelimiter = &Adaptive[*Sharded[*limiter.AIMD]]{}
+var _ WaitingRatelimiter = &Adaptive[*Sharded[*limiter.AIMD]]{}
+var _ DetailedRatelimiter = &Adaptive[*Sharded[*limiter.AIMD]]{}
+var _ ReservingRatelimiter = &Adaptive[*Sharded[*limiter.AIMD]]{}
+var _ ForcingRatelimiter = &Adaptive[*Sharded[*limiter.AIMD]]{}
+
+// NewAdaptive wraps a keyed ratelimiter of `limiter.AIMD`, see `NewAIMDLimiterFn`
+func NewAdaptive[R aimdRatelimiter](inner R) *Adaptive[R] {
+	return &Adaptive[R]{inner: inner}
+}
+
+// NewAIMDLimiterFn returns the newLimiterFn of keyed ratelimiters whose keys wrap the limiters of newLimiterFn with `limiter.AIMD`
+func NewAIMDLimiterFn(newLimiterFn func() limiter.Limiter, opt limiter.AIMDOption) func() *limiter.AIMD {
+	return func() *limiter.AIMD {
+		return limiter.NewAIMD(newLimiterFn(), opt)
+	}
+}
+
+func (d *Adaptive[R]) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	return d.inner.AllowN(key, cost, replenishPerSecond, burst)
+}
+
+// ForceN consumes the tokens of the key at its adapted rate even beyond the limit
+func (d *Adaptive[R]) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.inner.GetLimiter(key).ForceN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *Adaptive[R]) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return limiter.Result{}, err
+	}
+	return d.inner.GetLimiter(key).AllowNDetailed(cost, replenishPerSecond, burst), nil
+}
+
+func (d *Adaptive[R]) WaitN(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) error {
+	return limiter.WaitN(ctx, d.inner.GetLimiter(key), cost, replenishPerSecond, burst)
+}
+
+// ReserveN reserves the tokens of the key at its adapted rate
+func (d *Adaptive[R]) ReserveN(key string, cost int, replenishPerSecond float64, burst int) (*limiter.Reservation, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return nil, err
+	}
+	return d.inner.GetLimiter(key).ReserveN(cost, replenishPerSecond, burst), nil
+}
+
+// OnSuccess increases the rate of the key, see `limiter.AIMD.OnSuccess`
+func (d *Adaptive[R]) OnSuccess(key string) {
+	d.inner.GetLimiter(key).OnSuccess()
+}
+
+// OnOverload decreases the rate of the key, see `limiter.AIMD.OnOverload`
+func (d *Adaptive[R]) OnOverload(key string) {
+	d.inner.GetLimiter(key).OnOverload()
+}
@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"strconv"
+
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+)
+
+// Composite checks every limit of a `limiter.Policy` on a key, the request is denied if any limit fails without spending the others.
+// Every limit of a key is tracked by the wrapped ratelimiter under a key of its own, derived from the key and the limit,
+// so the local keyed ratelimiters and RedisDelayedSync can be wrapped alike.
+type Composite struct {
+	inner ReturningRatelimiter
+}
+
+func NewComposite(inner ReturningRatelimiter) *Composite {
+	return &Composite{inner: inner}
+}
+
+// AllowN admits the tokens if every limit of policy has capacity for the key
+func (c *Composite) AllowN(key string, cost int, policy limiter.Policy) (bool, error) {
+	admissions := make([]admission, len(policy))
+	for i, limit := range policy {
+		admissions[i] = admission{
+			allow: func() (bool, error) {
+				return c.inner.AllowN(limitKey(key, limit), cost, limit.ReplenishPerSecond, limit.Burst)
+			},
+			giveBack: func() error {
+				return c.inner.ReturnN(limitKey(key, limit), cost)
+			},
+		}
+	}
+	return allowAll(admissions)
+}
+
+// limitKey is the key under which a limit of a key is tracked, e.g. "user:1|0.5|10"
+func limitKey(key string, limit limiter.Limit) string {
+	return key + "|" + strconv.FormatFloat(limit.ReplenishPerSecond, 'g', -1, 64) + "|" + strconv.Itoa(limit.Burst)
+}
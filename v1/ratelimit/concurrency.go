@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+)
+
+// Concurrency is a keyed in-flight limiter, see `limiter.Concurrency`.
+// A key is dropped as soon as none of its slots are in flight, so idle keys take no memory.
+type Concurrency struct {
+	mu       sync.Mutex
+	limiters map[string]*limiter.Concurrency
+}
+
+var _ ConcurrencyLimiter = &Concurrency{}
+
+func NewConcurrency() *Concurrency {
+	return &Concurrency{
+		limiters: make(map[string]*limiter.Concurrency),
+	}
+}
+
+func (d *Concurrency) AcquireN(key string, n int, limit int) (func() error, bool, error) {
+	if n < 0 {
+		return nil, false, fmt.Errorf("%w: n=%d", limiter.ErrNegativeCost, n)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l, ok := d.limiters[key]
+	if !ok {
+		l = limiter.NewConcurrency()
+	}
+	if !l.AcquireN(n, limit) {
+		return nil, false, nil
+	}
+	d.limiters[key] = l
+	var once sync.Once
+	return func() error {
+		once.Do(func() {
+			d.releaseN(key, l, n)
+		})
+		return nil
+	}, true, nil
+}
+
+// InFlight returns the number of slots of the key in flight
+func (d *Concurrency) InFlight(key string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if l, ok := d.limiters[key]; ok {
+		return l.InFlight()
+	}
+	return 0
+}
+
+func (d *Concurrency) releaseN(key string, l *limiter.Concurrency, n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l.ReleaseN(n)
+	if l.InFlight() == 0 && d.limiters[key] == l {
+		delete(d.limiters, key)
+	}
+}
@@ -114,3 +114,37 @@ func benchmarkDistributed(b *testing.B, c benchmarkDistributedConfig) bool {
 	fmt.Printf("%s/custom_metrics\tallowed(rps/user)=%f\ttotal(rps/user)=%f\n", b.Name()+"/"+name, maxAllowed/maxLapsed/float64(c.totalConcurrency/c.avgConcurrencyPerUser), (maxAllowed+maxDisallowed)/maxLapsed/float64(c.totalConcurrency/c.avgConcurrencyPerUser))
 	return runResult
 }
+
+// BenchmarkRedisDelayedSyncSyncAll measures a sync cycle of many active keys, a batch size of 1 costs the round trips of syncing the keys one by one
+func BenchmarkRedisDelayedSyncSyncAll(b *testing.B) {
+	numKeys := 10000
+	if os.Getenv("NUM_KEYS") != "" {
+		numKeys, _ = strconv.Atoi(os.Getenv("NUM_KEYS"))
+	}
+	for _, batchSize := range []int{1, 100, DefaultRedisDelayedSyncBatchSize} {
+		b.Run(fmt.Sprintf("keys=%d;batch=%d", numKeys, batchSize), func(b *testing.B) {
+			rl := NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+				RedisClient:     newRDB(5),
+				DisableAutoSync: true,
+				SyncBatchSize:   batchSize,
+			})
+			keys := make([]string, numKeys)
+			for i := range keys {
+				keys[i] = test_utils.RandString(16)
+			}
+			b.ResetTimer()
+			for range b.N {
+				b.StopTimer()
+				// Every key has a delta to push
+				for _, key := range keys {
+					_, _ = rl.ForceN(key, 1, 1000, 1000)
+				}
+				b.StartTimer()
+				if err := rl.syncAll(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(numKeys)*float64(b.N)/b.Elapsed().Seconds(), "keys/s")
+		})
+	}
+}
@@ -2,11 +2,14 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/yesyoukenspace/go-ratelimit/internal/test_utils"
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
 )
 
 func TestDistributedAllow(t *testing.T) {
@@ -116,3 +119,119 @@ func testDistributedRatelimiter(t *testing.T, name string, constructor func() Ra
 		t.Logf("totalAllowed: %d, totalDenied: %d", totalAllowed, totalDenied)
 	})
 }
+
+func TestRedisConcurrency(t *testing.T) {
+	opt := RedisConcurrencyOption{
+		RedisClient: newRDB(2),
+		LeaseTTL:    500 * time.Millisecond,
+	}
+	alpha := NewRedisConcurrency(context.Background(), opt)
+	beta := NewRedisConcurrency(context.Background(), opt)
+	key := test_utils.RandString(10)
+
+	if _, ok, err := alpha.AcquireN(key, -100, 5); ok || !errors.Is(err, limiter.ErrNegativeCost) {
+		t.Fatalf("expected a negative n to be rejected, got ok=%t err=%v", ok, err)
+	}
+	release, ok, err := alpha.AcquireN(key, 3, 5)
+	if !ok || err != nil {
+		t.Fatalf("expected the slots to be acquired, got ok=%t err=%v", ok, err)
+	}
+	if _, ok, _ := beta.AcquireN(key, 3, 5); ok {
+		t.Fatalf("expected the slots of alpha to count on beta")
+	}
+	if _, ok, _ := beta.AcquireN(key, 2, 5); !ok {
+		t.Fatalf("expected the remaining slots to be acquired")
+	}
+	if err := release(); err != nil {
+		t.Fatalf("unexpected error on release: %v", err)
+	}
+	if inFlight, _ := beta.InFlight(key); inFlight != 2 {
+		t.Fatalf("expected 2 slots in flight, got %d", inFlight)
+	}
+	// The slots of beta are never released, they come back once the lease expires
+	time.Sleep(opt.LeaseTTL)
+	if _, ok, _ := alpha.AcquireN(key, 5, 5); !ok {
+		t.Fatalf("expected the expired leases to free their slots")
+	}
+}
+
+func TestRedisConcurrencyCtx(t *testing.T) {
+	rl := NewRedisConcurrency(context.Background(), RedisConcurrencyOption{RedisClient: newRDB(2)})
+	key := test_utils.RandString(10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release, ok, err := rl.AcquireNCtx(ctx, key, 2, 5)
+	if !ok || err != nil {
+		t.Fatalf("expected the slots to be acquired, got ok=%t err=%v", ok, err)
+	}
+	// The request is done before its work is, the slots are still given back
+	cancel()
+	if err := release(); err != nil {
+		t.Fatalf("unexpected error on release after ctx is done: %v", err)
+	}
+	if _, err := rl.InFlightCtx(ctx, key); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if inFlight, err := rl.InFlightCtx(context.Background(), key); inFlight != 0 || err != nil {
+		t.Fatalf("expected no slots in flight, got %d err=%v", inFlight, err)
+	}
+}
+
+func TestDistributedAllowNCtx(t *testing.T) {
+	ratelimiters := map[string]ContextRatelimiter{
+		"GoRedisRate": NewGoRedis(newRDB(2)),
+		"RedisDelayedSync": NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+			RedisClient:     newRDB(2),
+			DisableAutoSync: true,
+		}),
+	}
+	for name, rl := range ratelimiters {
+		t.Run(name, func(t *testing.T) {
+			key := test_utils.RandString(10)
+			if ok, err := rl.AllowNCtx(context.Background(), key, 1, 0.5, 1); !ok || err != nil {
+				t.Fatalf("expected allowed, got ok=%t err=%v", ok, err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if ok, err := rl.AllowNCtx(ctx, key, 1, 0.5, 1); ok || !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got ok=%t err=%v", ok, err)
+			}
+		})
+	}
+}
+
+func TestGoRedisRateForceN(t *testing.T) {
+	rl := NewGoRedis(newRDB(2))
+	key := test_utils.RandString(10)
+	// The forced tokens go beyond burst and are accounted by AllowN, which shares the key of redis_rate
+	if ok, err := rl.ForceN(key, 20, 0.5, 10); !ok || err != nil {
+		t.Fatalf("expected forced, got ok=%t err=%v", ok, err)
+	}
+	res, err := rl.AllowNDetailed(key, 1, 0.5, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 10 tokens beyond burst at 1 token per 2s
+	if res.Allowed || res.RetryAfter < 19*time.Second {
+		t.Fatalf("expected denied for about 20s, got %+v", res)
+	}
+}
+
+func TestRedisDelayedSyncUniversalClient(t *testing.T) {
+	// A single address gives a *redis.Client, several give a *redis.ClusterClient, both are synced the same way
+	rdb := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{"localhost:6379"}, DB: 2})
+	opt := RedisDelayedSyncOption{RedisClient: rdb, DisableAutoSync: true}
+	alpha := NewRedisDelayedSync(context.Background(), opt)
+	beta := NewRedisDelayedSync(context.Background(), opt)
+	key := test_utils.RandString(10)
+
+	_, _ = alpha.ForceN(key, 10, 1, 10)
+	for _, rl := range []*RedisDelayedSync{alpha, beta} {
+		if err := rl.SyncKey(key); err != nil {
+			t.Fatalf("SyncKey returned error: %v", err)
+		}
+	}
+	if allowed, _ := beta.AllowN(key, 1, 1, 10); allowed {
+		t.Fatalf("beta should deny once alpha's consumption is synced")
+	}
+}
@@ -1,6 +1,8 @@
 package ratelimit
 
 import (
+	"context"
+
 	"github.com/yesyoukenspace/go-ratelimit/limiter"
 )
 
@@ -10,6 +12,96 @@ type Ratelimiter interface {
 	AllowN(string, int, float64, int) (bool, error)
 }
 
+// ForcingRatelimiter is a Ratelimiter that can consume the tokens of a key even beyond the limit, see `limiter.Limiter.ForceN`
+// e.g. to charge for work that already happened, such as the bytes of a response
+type ForcingRatelimiter interface {
+	Ratelimiter
+	ForceN(string, int, float64, int) (bool, error)
+}
+
+// WaitingRatelimiter is a Ratelimiter that can block until the tokens are available, see `limiter.WaitN`
+type WaitingRatelimiter interface {
+	Ratelimiter
+	WaitN(context.Context, string, int, float64, int) error
+}
+
+// DetailedRatelimiter is a Ratelimiter that also reports the remaining tokens, reset time and retry-after of a key
+type DetailedRatelimiter interface {
+	Ratelimiter
+	AllowNDetailed(string, int, float64, int) (limiter.Result, error)
+}
+
+// ReservingRatelimiter is a Ratelimiter that can reserve the tokens of a key, see `limiter.Limiter.ReserveN`
+type ReservingRatelimiter interface {
+	Ratelimiter
+	ReserveN(string, int, float64, int) (*limiter.Reservation, error)
+}
+
+// ReturningRatelimiter is a Ratelimiter that can give consumed tokens of a key back, see `limiter.ReturnN`
+type ReturningRatelimiter interface {
+	Ratelimiter
+	ReturnN(string, int) error
+}
+
+// ContextRatelimiter is a Ratelimiter whose calls carry the context of the request, e.g. its deadline and tracing span, down to redis
+type ContextRatelimiter interface {
+	Ratelimiter
+	AllowNCtx(context.Context, string, int, float64, int) (bool, error)
+}
+
+// AllowNCtx calls `AllowNCtx` if r implements ContextRatelimiter.
+// Otherwise it returns the error of ctx if it is done and falls back to `AllowN`.
+func AllowNCtx(ctx context.Context, r Ratelimiter, key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if cr, ok := r.(ContextRatelimiter); ok {
+		return cr.AllowNCtx(ctx, key, cost, replenishPerSecond, burst)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.AllowN(key, cost, replenishPerSecond, burst)
+}
+
+// ContextForcingRatelimiter is a ForcingRatelimiter whose ForceN carries the context of the request down to redis, see ContextRatelimiter
+type ContextForcingRatelimiter interface {
+	ForcingRatelimiter
+	ForceNCtx(context.Context, string, int, float64, int) (bool, error)
+}
+
+// ForceNCtx calls `ForceNCtx` if r implements ContextForcingRatelimiter.
+// Otherwise it returns the error of ctx if it is done and falls back to `ForceN`.
+func ForceNCtx(ctx context.Context, r ForcingRatelimiter, key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if cr, ok := r.(ContextForcingRatelimiter); ok {
+		return cr.ForceNCtx(ctx, key, cost, replenishPerSecond, burst)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.ForceN(key, cost, replenishPerSecond, burst)
+}
+
 func NewDefaultLimiter() limiter.Limiter {
 	return limiter.NewResetbasedLimiter()
 }
+
+// NewFixedWindowLimiterFn returns the newLimiterFn of keyed ratelimiters whose keys count tokens in the aligned windows of opt,
+// the quota of every key resets at the same time
+func NewFixedWindowLimiterFn(opt limiter.FixedWindowOption) func() *limiter.FixedWindow {
+	return func() *limiter.FixedWindow {
+		return limiter.NewFixedWindow(opt)
+	}
+}
+
+// ConcurrencyLimiter caps the number of units of work in flight per key
+type ConcurrencyLimiter interface {
+	// AcquireN takes n slots of the key if at most limit slots end up in flight.
+	// release gives the slots back once the work is done, it is nil if the slots are not acquired and does nothing when called again.
+	// err wraps `limiter.ErrNegativeCost` if n is negative.
+	AcquireN(key string, n int, limit int) (release func() error, ok bool, err error)
+}
+
+// AdaptiveRatelimiter is a Ratelimiter whose keys adapt their rate to the feedback of the callers
+type AdaptiveRatelimiter interface {
+	Ratelimiter
+	OnSuccess(string)
+	OnOverload(string)
+}
@@ -2,31 +2,161 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/go-redis/redis_rate/v10"
 	"github.com/redis/go-redis/v9"
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
 )
 
+// ErrUnrepresentableRate is returned by `GoRedisRate` when replenishPerSecond cannot be expressed as a `redis_rate.Limit`
+var ErrUnrepresentableRate = errors.New("ratelimit: rate cannot be represented by redis_rate")
+
+// redisRatePrefix is the prefix redis_rate puts in front of the keys
+const redisRatePrefix = "rate:"
+
+// forceScript is the GCRA of redis_rate without the check, it moves the theoretical arrival time of the key by the cost regardless of the limit.
+// It keeps the key and the TAT format of redis_rate, seconds since 2017 as a float, so that forced and allowed calls account for each other.
+var forceScript = redis.NewScript(`
+redis.replicate_commands()
+
+local rate_limit_key = KEYS[1]
+local rate = ARGV[1]
+local period = ARGV[2]
+local cost = tonumber(ARGV[3])
+
+local emission_interval = period / rate
+local increment = emission_interval * cost
+
+local jan_1_2017 = 1483228800
+local now = redis.call("TIME")
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+local tat = redis.call("GET", rate_limit_key)
+if not tat then
+  tat = now
+else
+  tat = tonumber(tat)
+end
+tat = math.max(tat, now)
+
+local new_tat = tat + increment
+local reset_after = new_tat - now
+if reset_after > 0 then
+  redis.call("SET", rate_limit_key, new_tat, "EX", math.ceil(reset_after))
+end
+return 1
+`)
+
 type GoRedisRate struct {
-	ctx     context.Context
-	limiter *redis_rate.Limiter
+	ctx         context.Context
+	limiter     *redis_rate.Limiter
+	redisClient redis.UniversalClient
 }
 
-var _ Ratelimiter = &GoRedisRate{}
+var _ DetailedRatelimiter = &GoRedisRate{}
+var _ ContextRatelimiter = &GoRedisRate{}
+var _ ForcingRatelimiter = &GoRedisRate{}
+var _ ContextForcingRatelimiter = &GoRedisRate{}
 
 func (d *GoRedisRate) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
-	// TODO: rate here only works for more than 1 rps, allow for less than 1 rps, and integers only
-	res, err := d.limiter.AllowN(d.ctx, key, redis_rate.Limit{Rate: int(replenishPerSecond), Burst: burst, Period: time.Second}, cost)
+	return d.AllowNCtx(d.ctx, key, cost, replenishPerSecond, burst)
+}
+
+// AllowNCtx is AllowN with the redis call bound to ctx, e.g. to the deadline and tracing span of the request
+func (d *GoRedisRate) AllowNCtx(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	res, err := d.AllowNDetailedCtx(ctx, key, cost, replenishPerSecond, burst)
+	return res.Allowed, err
+}
+
+// ForceN consumes the tokens of the key even beyond the limit, the key is shared with AllowN
+func (d *GoRedisRate) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	return d.ForceNCtx(d.ctx, key, cost, replenishPerSecond, burst)
+}
+
+// ForceNCtx is ForceN with the redis call bound to ctx
+func (d *GoRedisRate) ForceNCtx(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	limit, err := toRedisRateLimit(replenishPerSecond, burst)
 	if err != nil {
 		return false, err
 	}
-	return res.Allowed > 0, nil
+	if err := forceScript.Run(ctx, d.redisClient, []string{redisRatePrefix + key}, limit.Rate, limit.Period.Seconds(), cost).Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AllowNDetailed is AllowN that fills the result from the `redis_rate.Result` of the call
+func (d *GoRedisRate) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	return d.AllowNDetailedCtx(d.ctx, key, cost, replenishPerSecond, burst)
+}
+
+// AllowNDetailedCtx is AllowNDetailed with the redis call bound to ctx
+func (d *GoRedisRate) AllowNDetailedCtx(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return limiter.Result{}, err
+	}
+	limit, err := toRedisRateLimit(replenishPerSecond, burst)
+	if err != nil {
+		return limiter.Result{}, err
+	}
+	res, err := d.limiter.AllowN(ctx, key, limit, cost)
+	if err != nil {
+		return limiter.Result{}, err
+	}
+	return toResult(res, cost), nil
+}
+
+// toRedisRateLimit expresses replenishPerSecond as a whole number of tokens per second, minute or hour, e.g. 0.5 becomes 30 per minute.
+// Otherwise it uses one token per period of 1/replenishPerSecond, e.g. 1/7 becomes 1 per 7s, as long as the period is a whole number of nanoseconds.
+func toRedisRateLimit(replenishPerSecond float64, burst int) (redis_rate.Limit, error) {
+	for _, period := range []time.Duration{time.Second, time.Minute, time.Hour} {
+		rate := replenishPerSecond * period.Seconds()
+		if rate >= 1 && rate <= math.MaxInt32 && isWhole(rate) {
+			return redis_rate.Limit{Rate: int(math.Round(rate)), Burst: burst, Period: period}, nil
+		}
+	}
+	period := float64(time.Second) / replenishPerSecond
+	if period >= 1 && period <= math.MaxInt64 && isWhole(period) {
+		return redis_rate.Limit{Rate: 1, Burst: burst, Period: time.Duration(math.Round(period))}, nil
+	}
+	return redis_rate.Limit{}, fmt.Errorf("%w: %v per second", ErrUnrepresentableRate, replenishPerSecond)
+}
+
+// isWhole tolerates the rounding error of the float operations that produced f
+func isWhole(f float64) bool {
+	return math.Abs(f-math.Round(f)) <= 1e-12*math.Max(f, 1)
+}
+
+func toResult(res *redis_rate.Result, cost int) limiter.Result {
+	result := limiter.Result{
+		Allowed:   res.Allowed > 0,
+		Remaining: res.Remaining,
+		ResetAt:   time.Now().Add(res.ResetAfter),
+	}
+	switch {
+	case result.Allowed:
+		// redis_rate uses -1 to signal that the request was allowed
+		result.RetryAfter = 0
+	case cost > res.Limit.Burst:
+		result.RetryAfter = -1
+	default:
+		result.RetryAfter = res.RetryAfter
+	}
+	return result
 }
 
-func NewGoRedis(redisClient *redis.Client) *GoRedisRate {
+// NewGoRedis accepts any `redis.UniversalClient`, the scripts of redis_rate and of ForceN touch a single key so they run on a cluster as well
+func NewGoRedis(redisClient redis.UniversalClient) *GoRedisRate {
 	return &GoRedisRate{
-		ctx:     context.Background(),
-		limiter: redis_rate.NewLimiter(redisClient),
+		ctx:         context.Background(),
+		limiter:     redis_rate.NewLimiter(redisClient),
+		redisClient: redisClient,
 	}
 }
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HierarchyLevel is a level of a Hierarchical ratelimiter, e.g. the users, the tenants or the global limit
+type HierarchyLevel struct {
+	Ratelimiter        ReturningRatelimiter
+	ReplenishPerSecond float64
+	Burst              int
+}
+
+// Hierarchical enforces nested limits in one call, e.g. a user inside a tenant inside a global limit.
+// A request is admitted only if every level has capacity, no level spends tokens when one of them rejects.
+//
+// The levels are not locked together: a request takes its tokens level by level with AllowN, which spends nothing when the level rejects,
+// and the levels that admitted it get their tokens back with ReturnN when a later level rejects it.
+type Hierarchical struct {
+	levels []HierarchyLevel
+}
+
+func NewHierarchical(levels ...HierarchyLevel) *Hierarchical {
+	return &Hierarchical{levels: levels}
+}
+
+// AllowN admits the tokens if every level has capacity, keys[i] is the key of the request at the i-th level
+func (h *Hierarchical) AllowN(keys []string, cost int) (bool, error) {
+	if len(keys) != len(h.levels) {
+		return false, fmt.Errorf("expected %d keys, one per level, got %d", len(h.levels), len(keys))
+	}
+	admissions := make([]admission, len(h.levels))
+	for i, level := range h.levels {
+		admissions[i] = admission{
+			allow: func() (bool, error) {
+				return level.Ratelimiter.AllowN(keys[i], cost, level.ReplenishPerSecond, level.Burst)
+			},
+			giveBack: func() error {
+				return level.Ratelimiter.ReturnN(keys[i], cost)
+			},
+		}
+	}
+	return allowAll(admissions)
+}
+
+// admission takes the tokens of a request from one limit and gives them back
+type admission struct {
+	allow    func() (bool, error)
+	giveBack func() error
+}
+
+// allowAll admits the tokens only if every admission allows them.
+// Otherwise the tokens of the admissions that allowed them are given back, the one that rejected spent nothing.
+func allowAll(admissions []admission) (bool, error) {
+	for i, a := range admissions {
+		ok, err := a.allow()
+		if err == nil && ok {
+			continue
+		}
+		errs := []error{err}
+		for _, admitted := range admissions[:i] {
+			errs = append(errs, admitted.giveBack())
+		}
+		return false, errors.Join(errs...)
+	}
+	return true, nil
+}
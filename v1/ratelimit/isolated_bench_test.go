@@ -42,6 +42,8 @@ func BenchmarkIsolated(b *testing.B) {
 		{name: "SyncMap + LoadOrStore", limiter: NewSyncMapLoadOrStore(NewDefaultLimiter)},
 		{name: "SyncMap + Load > LoadOrStore", limiter: NewSyncMapLoadThenLoadOrStore(NewDefaultLimiter)},
 		{name: "SyncMap + Load > Store", limiter: NewSyncMapLoadThenStore(NewDefaultLimiter)},
+		{name: "LRU", limiter: NewLRU(NewDefaultLimiter, LRUOption{})},
+		{name: "Sharded", limiter: NewSharded(NewDefaultLimiter, ShardedOption{})},
 		{name: "Redis", limiter: NewGoRedis(redisClient)},
 		{name: "Redis With Delay (2 syncs per second)", limiter: NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
 			RedisClient:  redisClient,
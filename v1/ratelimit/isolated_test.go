@@ -2,11 +2,18 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/yesyoukenspace/go-ratelimit/internal/test_utils"
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+	"github.com/yesyoukenspace/go-ratelimit/limiter/limitertest"
 )
 
 func TestIsolatedAllow(t *testing.T) {
@@ -68,6 +75,18 @@ func TestIsolatedAllow(t *testing.T) {
 				return NewRWMutex(NewDefaultLimiter)
 			},
 		},
+		{
+			name: "LRU",
+			constructor: func() Ratelimiter {
+				return NewLRU(NewDefaultLimiter, LRUOption{MaxKeys: 16})
+			},
+		},
+		{
+			name: "Sharded",
+			constructor: func() Ratelimiter {
+				return NewSharded(NewDefaultLimiter, ShardedOption{})
+			},
+		},
 		{
 			name: "Redis",
 			constructor: func() Ratelimiter {
@@ -91,6 +110,704 @@ func TestIsolatedAllow(t *testing.T) {
 	}
 }
 
+func TestIsolatedWaitN(t *testing.T) {
+	ratelimiters := []struct {
+		name        string
+		constructor func() WaitingRatelimiter
+	}{
+		{name: "SyncMap + Load > LoadOrStore", constructor: func() WaitingRatelimiter { return NewSyncMapLoadThenLoadOrStore(NewDefaultLimiter) }},
+		{name: "SyncMap + Load > Store", constructor: func() WaitingRatelimiter { return NewSyncMapLoadThenStore(NewDefaultLimiter) }},
+		{name: "SyncMap + LoadOrStore", constructor: func() WaitingRatelimiter { return NewSyncMapLoadOrStore(NewDefaultLimiter) }},
+		{name: "Map + Mutex", constructor: func() WaitingRatelimiter { return NewMutex(NewDefaultLimiter) }},
+		{name: "Map + RWMutex", constructor: func() WaitingRatelimiter { return NewRWMutex(NewDefaultLimiter) }},
+		{name: "LRU", constructor: func() WaitingRatelimiter { return NewLRU(NewDefaultLimiter, LRUOption{}) }},
+		{name: "Sharded", constructor: func() WaitingRatelimiter { return NewSharded(NewDefaultLimiter, ShardedOption{}) }},
+	}
+	for _, ratelimiter := range ratelimiters {
+		t.Run(ratelimiter.name, func(t *testing.T) {
+			t.Parallel()
+			rl := ratelimiter.constructor()
+			key := test_utils.RandString(4)
+
+			if err := rl.WaitN(context.Background(), key, 2, 10, 1); !errors.Is(err, limiter.ErrExceedsBurst) {
+				t.Fatalf("expected ErrExceedsBurst, got %v", err)
+			}
+			if err := rl.WaitN(context.Background(), key, 1, 10, 1); err != nil {
+				t.Fatalf("first wait should not block: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if err := rl.WaitN(ctx, key, 1, 10, 1); !errors.Is(err, limiter.ErrWaitExceedsDeadline) {
+				t.Fatalf("expected ErrWaitExceedsDeadline, got %v", err)
+			}
+
+			cancelled, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := rl.WaitN(cancelled, key, 1, 10, 1); !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+
+			start := time.Now()
+			if err := rl.WaitN(context.Background(), key, 1, 10, 1); err != nil {
+				t.Fatalf("wait should succeed: %v", err)
+			}
+			if waited := time.Since(start); waited < 50*time.Millisecond {
+				t.Fatalf("expected to wait for the token to replenish, waited %s", waited)
+			}
+			if ok, _ := rl.AllowN(key, 1, 10, 1); ok {
+				t.Fatalf("token should have been consumed by the wait")
+			}
+		})
+	}
+}
+
+func TestIsolatedAllowNDetailed(t *testing.T) {
+	ratelimiters := []struct {
+		name        string
+		constructor func() DetailedRatelimiter
+	}{
+		{name: "SyncMap + Load > LoadOrStore", constructor: func() DetailedRatelimiter { return NewSyncMapLoadThenLoadOrStore(NewDefaultLimiter) }},
+		{name: "SyncMap + Load > Store", constructor: func() DetailedRatelimiter { return NewSyncMapLoadThenStore(NewDefaultLimiter) }},
+		{name: "SyncMap + LoadOrStore", constructor: func() DetailedRatelimiter { return NewSyncMapLoadOrStore(NewDefaultLimiter) }},
+		{name: "Map + Mutex", constructor: func() DetailedRatelimiter { return NewMutex(NewDefaultLimiter) }},
+		{name: "Map + RWMutex", constructor: func() DetailedRatelimiter { return NewRWMutex(NewDefaultLimiter) }},
+		{name: "LRU", constructor: func() DetailedRatelimiter { return NewLRU(NewDefaultLimiter, LRUOption{}) }},
+		{name: "Sharded", constructor: func() DetailedRatelimiter { return NewSharded(NewDefaultLimiter, ShardedOption{}) }},
+		{name: "Redis", constructor: func() DetailedRatelimiter { return NewGoRedis(newRDB()) }},
+	}
+	for _, ratelimiter := range ratelimiters {
+		t.Run(ratelimiter.name, func(t *testing.T) {
+			t.Parallel()
+			rl := ratelimiter.constructor()
+			key := test_utils.RandString(4)
+
+			res, err := rl.AllowNDetailed(key, 3, 1, 5)
+			if err != nil {
+				t.Fatalf("failed to allow: %v", err)
+			}
+			if !res.Allowed || res.Remaining != 2 || res.RetryAfter != 0 {
+				t.Fatalf("expected allowed with 2 remaining, got %+v", res)
+			}
+			if resetIn := time.Until(res.ResetAt); !test_utils.IsCloseEnough(float64(3*time.Second), float64(resetIn), 0.05) {
+				t.Fatalf("expected reset in 3s, got %s", resetIn)
+			}
+
+			res, err = rl.AllowNDetailed(key, 4, 1, 5)
+			if err != nil {
+				t.Fatalf("failed to allow: %v", err)
+			}
+			// redis_rate reports 0 remaining on denials
+			if res.Allowed || res.Remaining > 2 {
+				t.Fatalf("expected denied with at most 2 remaining, got %+v", res)
+			}
+			if !test_utils.IsCloseEnough(float64(2*time.Second), float64(res.RetryAfter), 0.05) {
+				t.Fatalf("expected retry after 2s, got %s", res.RetryAfter)
+			}
+		})
+	}
+}
+
+type janitorRatelimiter interface {
+	Ratelimiter
+	StartJanitor(context.Context, JanitorOption)
+	sweep(JanitorOption, time.Time)
+}
+
+func countKeys(rl janitorRatelimiter) int {
+	count := 0
+	countSyncMap := func(m *sync.Map) {
+		m.Range(func(_, _ any) bool {
+			count++
+			return true
+		})
+	}
+	switch rl := rl.(type) {
+	case *Mutex[limiter.Limiter]:
+		rl.mu.Lock()
+		count = len(rl.limiters)
+		rl.mu.Unlock()
+	case *RWMutex[limiter.Limiter]:
+		rl.mu.RLock()
+		count = len(rl.limiters)
+		rl.mu.RUnlock()
+	case *SyncMapLoadThenLoadOrStore[limiter.Limiter]:
+		countSyncMap(&rl.limiters)
+	case *SyncMapLoadOrStore[limiter.Limiter]:
+		countSyncMap(&rl.limiters)
+	case *SyncMapLoadThenStore[limiter.Limiter]:
+		countSyncMap(&rl.limiters)
+	case *Sharded[limiter.Limiter]:
+		for i := range rl.shards {
+			rl.shards[i].mu.RLock()
+			count += len(rl.shards[i].limiters)
+			rl.shards[i].mu.RUnlock()
+		}
+	}
+	return count
+}
+
+func TestIsolatedJanitor(t *testing.T) {
+	ratelimiters := []struct {
+		name        string
+		constructor func() janitorRatelimiter
+	}{
+		{name: "SyncMap + Load > LoadOrStore", constructor: func() janitorRatelimiter { return NewSyncMapLoadThenLoadOrStore(NewDefaultLimiter) }},
+		{name: "SyncMap + Load > Store", constructor: func() janitorRatelimiter { return NewSyncMapLoadThenStore(NewDefaultLimiter) }},
+		{name: "SyncMap + LoadOrStore", constructor: func() janitorRatelimiter { return NewSyncMapLoadOrStore(NewDefaultLimiter) }},
+		{name: "Map + Mutex", constructor: func() janitorRatelimiter { return NewMutex(NewDefaultLimiter) }},
+		{name: "Map + RWMutex", constructor: func() janitorRatelimiter { return NewRWMutex(NewDefaultLimiter) }},
+		{name: "Sharded", constructor: func() janitorRatelimiter { return NewSharded(NewDefaultLimiter, ShardedOption{Shards: 4}) }},
+	}
+	for _, ratelimiter := range ratelimiters {
+		t.Run(ratelimiter.name+"/IdleTTL", func(t *testing.T) {
+			t.Parallel()
+			rl := ratelimiter.constructor()
+			opt := JanitorOption{IdleTTL: time.Minute}
+			now := time.Now()
+			if ok, _ := rl.AllowN("key", 1, 1, 1); !ok {
+				t.Fatalf("first request should be allowed")
+			}
+			if ok, _ := rl.AllowN("key", 1, 1, 1); ok {
+				t.Fatalf("second request should be denied")
+			}
+			rl.sweep(opt, now)
+			rl.sweep(opt, now.Add(30*time.Second))
+			if ok, _ := rl.AllowN("key", 1, 1, 1); ok {
+				t.Fatalf("key should not be evicted before the idle ttl")
+			}
+			// The request above touched the key, so the idle period restarts from this sweep
+			rl.sweep(opt, now.Add(61*time.Second))
+			if countKeys(rl) != 1 {
+				t.Fatalf("key should not be evicted after being used")
+			}
+			rl.sweep(opt, now.Add(122*time.Second))
+			if countKeys(rl) != 0 {
+				t.Fatalf("key should be evicted after the idle ttl")
+			}
+			if ok, _ := rl.AllowN("key", 1, 1, 1); !ok {
+				t.Fatalf("evicted key should come back with a fresh limiter")
+			}
+		})
+		t.Run(ratelimiter.name+"/EvictReplenished", func(t *testing.T) {
+			t.Parallel()
+			rl := ratelimiter.constructor()
+			opt := JanitorOption{EvictReplenished: true}
+			_, _ = rl.AllowN("key", 1, 1, 10)
+			rl.sweep(opt, time.Now())
+			if countKeys(rl) != 1 {
+				t.Fatalf("key should not be evicted before it is replenished")
+			}
+			rl.sweep(opt, time.Now().Add(2*time.Second))
+			if countKeys(rl) != 0 {
+				t.Fatalf("key should be evicted once it is replenished")
+			}
+		})
+		t.Run(ratelimiter.name+"/EvictReplenishedTouched", func(t *testing.T) {
+			t.Parallel()
+			rl := ratelimiter.constructor()
+			opt := JanitorOption{EvictReplenished: true}
+			if ok, _ := rl.AllowN("key", 1, 1, 1); !ok {
+				t.Fatalf("first request should be allowed")
+			}
+			// The key is replenished at the time of the sweep but was used since the previous one
+			rl.sweep(opt, time.Now().Add(2*time.Second))
+			if countKeys(rl) != 1 {
+				t.Fatalf("key used since the previous sweep should not be evicted")
+			}
+			if ok, _ := rl.AllowN("key", 1, 1, 1); ok {
+				t.Fatalf("second request should be denied")
+			}
+		})
+		t.Run(ratelimiter.name+"/StartJanitor", func(t *testing.T) {
+			t.Parallel()
+			rl := ratelimiter.constructor()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			rl.StartJanitor(ctx, JanitorOption{Interval: 10 * time.Millisecond, EvictReplenished: true})
+			for i := range 100 {
+				_, _ = rl.AllowN(strconv.Itoa(i), 1, 1000, 1)
+			}
+			time.Sleep(100 * time.Millisecond)
+			if n := countKeys(rl); n != 0 {
+				t.Fatalf("expected all keys to be evicted, %d left", n)
+			}
+		})
+	}
+}
+
+func TestIsolatedJanitorClock(t *testing.T) {
+	clock := limitertest.NewManualClock(time.Unix(0, 0))
+	rl := NewMutex(func() limiter.Limiter { return limiter.NewResetbasedLimiterWithClock(clock) })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rl.StartJanitor(ctx, JanitorOption{Interval: 10 * time.Millisecond, EvictReplenished: true, Clock: clock})
+	_, _ = rl.AllowN("key", 1, 1, 1)
+	time.Sleep(100 * time.Millisecond)
+	if countKeys(rl) != 1 {
+		t.Fatalf("key should not be evicted before the clock replenishes it")
+	}
+	clock.Advance(2 * time.Second)
+	time.Sleep(100 * time.Millisecond)
+	if countKeys(rl) != 0 {
+		t.Fatalf("key should be evicted once the clock replenishes it")
+	}
+}
+
+func TestIsolatedLRU(t *testing.T) {
+	rl := NewLRU(NewDefaultLimiter, LRUOption{MaxKeys: 2})
+	for _, key := range []string{"a", "b"} {
+		if ok, _ := rl.AllowN(key, 1, 1, 1); !ok {
+			t.Fatalf("first request of %s should be allowed", key)
+		}
+	}
+	// "a" becomes the most recently used key, so "b" is evicted when "c" is added
+	if ok, _ := rl.AllowN("a", 1, 1, 1); ok {
+		t.Fatalf("second request of a should be denied")
+	}
+	if ok, _ := rl.AllowN("c", 1, 1, 1); !ok {
+		t.Fatalf("first request of c should be allowed")
+	}
+	if rl.Len() != 2 {
+		t.Fatalf("expected 2 keys, got %d", rl.Len())
+	}
+	if ok, _ := rl.AllowN("a", 1, 1, 1); ok {
+		t.Fatalf("a should not have been evicted")
+	}
+	if ok, _ := rl.AllowN("b", 1, 1, 1); !ok {
+		t.Fatalf("b should have been evicted and come back with a fresh limiter")
+	}
+}
+
+func TestIsolatedFixedWindow(t *testing.T) {
+	// The helper plugs into every keyed ratelimiter
+	var _ DetailedRatelimiter = NewSharded(NewFixedWindowLimiterFn(limiter.FixedWindowOption{Window: time.Minute}), ShardedOption{})
+
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 12, 0, 30, 0, time.UTC))
+	rl := NewMutex(func() *limiter.FixedWindow {
+		return limiter.NewFixedWindowWithClock(limiter.FixedWindowOption{Window: time.Minute}, clock)
+	})
+	for _, key := range []string{"a", "b"} {
+		res, err := rl.AllowNDetailed(key, 10, 1, 10)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Every key resets at the next calendar minute regardless of when it was first used
+		if want := time.Date(2025, 1, 1, 12, 1, 0, 0, time.UTC); !res.Allowed || !res.ResetAt.Equal(want) {
+			t.Fatalf("expected %s to be allowed with reset at %s, got %+v", key, want, res)
+		}
+		clock.Advance(10 * time.Second)
+	}
+	if ok, _ := rl.AllowN("a", 1, 1, 10); ok {
+		t.Fatalf("a should be denied until the next minute")
+	}
+	clock.Advance(10 * time.Second)
+	for _, key := range []string{"a", "b"} {
+		if ok, _ := rl.AllowN(key, 10, 1, 10); !ok {
+			t.Fatalf("%s should be allowed in the next minute", key)
+		}
+	}
+}
+
+func TestIsolatedConcurrency(t *testing.T) {
+	rl := NewConcurrency()
+	releases := []func() error{}
+	for range 5 {
+		release, ok, err := rl.AcquireN("tenant", 1, 5)
+		if !ok || err != nil {
+			t.Fatalf("expected the slot to be acquired, got ok=%t err=%v", ok, err)
+		}
+		releases = append(releases, release)
+	}
+	if release, ok, _ := rl.AcquireN("tenant", 1, 5); ok || release != nil {
+		t.Fatalf("expected the 6th slot to be denied")
+	}
+	if _, ok, _ := rl.AcquireN("other", 5, 5); !ok {
+		t.Fatalf("expected the slots of another key to be independent")
+	}
+	if _, ok, err := rl.AcquireN("tenant", -100, 5); ok || !errors.Is(err, limiter.ErrNegativeCost) {
+		t.Fatalf("expected a negative n to be rejected, got ok=%t err=%v", ok, err)
+	}
+	// Releasing twice gives the slot back once
+	_ = releases[0]()
+	_ = releases[0]()
+	if rl.InFlight("tenant") != 4 {
+		t.Fatalf("expected 4 slots in flight, got %d", rl.InFlight("tenant"))
+	}
+	for _, release := range releases[1:] {
+		_ = release()
+	}
+	rl.mu.Lock()
+	_, exists := rl.limiters["tenant"]
+	rl.mu.Unlock()
+	if exists {
+		t.Fatalf("expected the key to be dropped once no slot is in flight")
+	}
+}
+
+func TestIsolatedAdaptive(t *testing.T) {
+	rl := NewAdaptive(NewMutex(NewAIMDLimiterFn(NewDefaultLimiter, limiter.AIMDOption{})))
+	for _, key := range []string{"a", "b"} {
+		if ok, _ := rl.AllowN(key, 1, 100, 1); !ok {
+			t.Fatalf("first request of %s should be allowed", key)
+		}
+	}
+	rl.OnOverload("a")
+	rl.OnOverload("a")
+	if rate := rl.inner.GetLimiter("a").Rate(); rate != 25 {
+		t.Fatalf("expected the rate of a to be 25, got %f", rate)
+	}
+	rl.OnSuccess("a")
+	if rate := rl.inner.GetLimiter("a").Rate(); rate != 26 {
+		t.Fatalf("expected the rate of a to be 26, got %f", rate)
+	}
+	if rate := rl.inner.GetLimiter("b").Rate(); rate != 100 {
+		t.Fatalf("expected the rate of b to be unaffected, got %f", rate)
+	}
+}
+
+func TestIsolatedHierarchical(t *testing.T) {
+	newLimiterFns := map[string]func() limiter.Limiter{
+		"ResetBasedLimiter": NewDefaultLimiter,
+		"Bucket": func() limiter.Limiter {
+			return limiter.NewBucket()
+		},
+	}
+	for name, newLimiterFn := range newLimiterFns {
+		t.Run(name, func(t *testing.T) {
+			users := NewMutex(newLimiterFn)
+			tenants := NewSharded(newLimiterFn, ShardedOption{})
+			// No sync happens without the auto sync loop, so no redis is needed
+			global := NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{DisableAutoSync: true})
+			rl := NewHierarchical(
+				HierarchyLevel{Ratelimiter: users, ReplenishPerSecond: 0.001, Burst: 2},
+				HierarchyLevel{Ratelimiter: tenants, ReplenishPerSecond: 0.001, Burst: 3},
+				HierarchyLevel{Ratelimiter: global, ReplenishPerSecond: 0.001, Burst: 100},
+			)
+
+			for i := range 2 {
+				if ok, err := rl.AllowN([]string{"u1", "t1", "global"}, 1); !ok || err != nil {
+					t.Fatalf("request %d of u1 should be allowed, got ok=%t err=%v", i, ok, err)
+				}
+			}
+			// Rejected by the user level, the tenant keeps its last token
+			if ok, _ := rl.AllowN([]string{"u1", "t1", "global"}, 1); ok {
+				t.Fatalf("u1 should be denied by the user level")
+			}
+			if ok, _ := rl.AllowN([]string{"u2", "t1", "global"}, 1); !ok {
+				t.Fatalf("u2 should be allowed with the last token of the tenant")
+			}
+			// Rejected by the tenant level, the user level is rolled back
+			if ok, _ := rl.AllowN([]string{"u2", "t1", "global"}, 1); ok {
+				t.Fatalf("u2 should be denied by the tenant level")
+			}
+			if ok, _ := users.AllowN("u2", 1, 0.001, 2); !ok {
+				t.Fatalf("the rejected request should not have spent the token of u2")
+			}
+			// 3 requests were admitted, the rejected ones did not spend the global level
+			if res, _ := global.AllowNDetailed("global", 1, 0.001, 100); res.Remaining != 96 {
+				t.Fatalf("expected 96 global tokens remaining, got %d", res.Remaining)
+			}
+			if _, err := rl.AllowN([]string{"u1"}, 1); err == nil {
+				t.Fatalf("expected an error when the keys do not match the levels")
+			}
+		})
+	}
+}
+
+// hookedRatelimiter calls beforeAllowN before every AllowN, e.g. to run a concurrent request in the middle of another one
+type hookedRatelimiter struct {
+	ReturningRatelimiter
+	beforeAllowN func()
+}
+
+func (r *hookedRatelimiter) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	r.beforeAllowN()
+	return r.ReturningRatelimiter.AllowN(key, cost, replenishPerSecond, burst)
+}
+
+func TestIsolatedHierarchicalOverlappingRejections(t *testing.T) {
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	newLimiterFn := func() limiter.Limiter {
+		return limiter.NewResetbasedLimiterWithClock(clock)
+	}
+	users := NewMutex(newLimiterFn)
+	tenants := &hookedRatelimiter{ReturningRatelimiter: NewMutex(newLimiterFn), beforeAllowN: func() {}}
+	rl := NewHierarchical(
+		HierarchyLevel{Ratelimiter: users, ReplenishPerSecond: 1, Burst: 2},
+		HierarchyLevel{Ratelimiter: tenants, ReplenishPerSecond: 1, Burst: 1},
+	)
+	if ok, _ := tenants.AllowN("t1", 1, 1, 1); !ok {
+		t.Fatalf("the token of the tenant should be spent")
+	}
+	for range 10 {
+		// A second request passes the user level while the first one holds its token, both are rejected by the tenant
+		overlapping := true
+		tenants.beforeAllowN = func() {
+			if overlapping {
+				overlapping = false
+				if ok, _ := rl.AllowN([]string{"u1", "t1"}, 1); ok {
+					t.Fatalf("the overlapping request should be denied by the tenant level")
+				}
+			}
+		}
+		if ok, _ := rl.AllowN([]string{"u1", "t1"}, 1); ok {
+			t.Fatalf("the request should be denied by the tenant level")
+		}
+	}
+	tenants.beforeAllowN = func() {}
+	// The rejected requests gave their tokens back, the user level is still at full burst
+	if ok, _ := users.AllowN("u1", 2, 1, 2); !ok {
+		t.Fatalf("the rejected requests should not have spent the tokens of u1")
+	}
+	clock.Advance(time.Second)
+	if ok, _ := rl.AllowN([]string{"u2", "t1"}, 1); !ok {
+		t.Fatalf("the tenant level should recover once it replenishes")
+	}
+}
+
+func TestIsolatedComposite(t *testing.T) {
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	newLimiterFn := func() limiter.SyncableLimiter {
+		return limiter.NewResetbasedLimiterWithClock(clock)
+	}
+	ratelimiters := map[string]ReturningRatelimiter{
+		"Mutex":   NewMutex(newLimiterFn),
+		"Sharded": NewSharded(newLimiterFn, ShardedOption{}),
+		// No sync happens without the auto sync loop, so no redis is needed
+		"RedisDelayedSync": NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+			DisableAutoSync: true,
+			Clock:           clock,
+		}),
+	}
+	perSecond := limiter.Limit{ReplenishPerSecond: 10, Burst: 2}
+	quota := limiter.Limit{ReplenishPerSecond: 0.001, Burst: 3}
+	resetAts := func(inner ReturningRatelimiter, key string) []int64 {
+		var resetAts []int64
+		for _, limit := range []limiter.Limit{perSecond, quota} {
+			switch inner := inner.(type) {
+			case *Mutex[limiter.SyncableLimiter]:
+				resetAts = append(resetAts, inner.GetLimiter(limitKey(key, limit)).GetResetAt())
+			case *Sharded[limiter.SyncableLimiter]:
+				resetAts = append(resetAts, inner.GetLimiter(limitKey(key, limit)).GetResetAt())
+			case *RedisDelayedSync:
+				resetAts = append(resetAts, inner.GetResetAt(limitKey(key, limit)))
+			}
+		}
+		return resetAts
+	}
+	for name, inner := range ratelimiters {
+		t.Run(name, func(t *testing.T) {
+			rl := NewComposite(inner)
+			key := test_utils.RandString(10)
+			for i := range 2 {
+				if ok, err := rl.AllowN(key, 1, limiter.Policy{perSecond, quota}); !ok || err != nil {
+					t.Fatalf("request %d should be allowed, got ok=%t err=%v", i, ok, err)
+				}
+			}
+			if ok, _ := rl.AllowN(key, 1, limiter.Policy{perSecond, quota}); ok {
+				t.Fatalf("request should be denied by the per second limit")
+			}
+			clock.Advance(time.Second)
+			if ok, _ := rl.AllowN(key, 1, limiter.Policy{perSecond, quota}); !ok {
+				t.Fatalf("request should be allowed with the last token of the quota")
+			}
+			before := resetAts(inner, key)
+			if ok, _ := rl.AllowN(key, 1, limiter.Policy{perSecond, quota}); ok {
+				t.Fatalf("request should be denied by the quota")
+			}
+			if after := resetAts(inner, key); len(after) != 2 || !slices.Equal(before, after) {
+				t.Fatalf("the rejected request should leave every limit unchanged, resetAt went from %v to %v", before, after)
+			}
+			// The request denied by the quota did not spend the per second limit
+			if ok, _ := rl.AllowN(key, 1, limiter.Policy{perSecond}); !ok {
+				t.Fatalf("the per second limit should have a token left")
+			}
+			if ok, _ := rl.AllowN(key, 1, limiter.Policy{perSecond}); ok {
+				t.Fatalf("the per second limit should be spent")
+			}
+		})
+	}
+}
+
+func TestIsolatedLimit(t *testing.T) {
+	rl := NewMutex(NewDefaultLimiter)
+	limit := limiter.PerMinute(2)
+	for i := range 2 {
+		if ok, err := AllowNLimit(rl, "a", 1, limit); !ok || err != nil {
+			t.Fatalf("request %d should be allowed, got ok=%t err=%v", i, ok, err)
+		}
+	}
+	if res, _ := AllowNDetailedLimit(rl, "a", 1, limit); res.Allowed || !test_utils.IsCloseEnough(float64(30*time.Second), float64(res.RetryAfter), 0.01) {
+		t.Fatalf("expected denied with retry after 30s, got %+v", res)
+	}
+}
+
+func TestIsolatedValidation(t *testing.T) {
+	tests := []struct {
+		cost               int
+		replenishPerSecond float64
+		burst              int
+		err                error
+	}{
+		{cost: -1, replenishPerSecond: 1, burst: 1, err: limiter.ErrNegativeCost},
+		{cost: 1, replenishPerSecond: 0, burst: 1, err: limiter.ErrInvalidRate},
+		{cost: 1, replenishPerSecond: -1, burst: 1, err: limiter.ErrInvalidRate},
+		{cost: 1, replenishPerSecond: 1, burst: -1, err: limiter.ErrInvalidBurst},
+	}
+	ratelimiters := map[string]interface {
+		DetailedRatelimiter
+		WaitingRatelimiter
+		ReservingRatelimiter
+	}{
+		"Mutex":   NewMutex(NewDefaultLimiter),
+		"SyncMap": NewSyncMapLoadThenStore(NewDefaultLimiter),
+		"Sharded": NewSharded(NewDefaultLimiter, ShardedOption{}),
+		"RedisDelayedSync": NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+			DisableAutoSync: true,
+		}),
+	}
+	for name, rl := range ratelimiters {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("ratelimiter=%s;err=%s", name, tt.err), func(t *testing.T) {
+				if ok, err := rl.AllowN("a", tt.cost, tt.replenishPerSecond, tt.burst); ok || !errors.Is(err, tt.err) {
+					t.Fatalf("AllowN: expected %v, got ok=%t err=%v", tt.err, ok, err)
+				}
+				if _, err := rl.AllowNDetailed("a", tt.cost, tt.replenishPerSecond, tt.burst); !errors.Is(err, tt.err) {
+					t.Fatalf("AllowNDetailed: expected %v, got %v", tt.err, err)
+				}
+				if err := rl.WaitN(context.Background(), "a", tt.cost, tt.replenishPerSecond, tt.burst); !errors.Is(err, tt.err) {
+					t.Fatalf("WaitN: expected %v, got %v", tt.err, err)
+				}
+				if _, err := rl.ReserveN("a", tt.cost, tt.replenishPerSecond, tt.burst); !errors.Is(err, tt.err) {
+					t.Fatalf("ReserveN: expected %v, got %v", tt.err, err)
+				}
+			})
+		}
+	}
+}
+
+func TestIsolatedReturnN(t *testing.T) {
+	ratelimiters := map[string]ReturningRatelimiter{
+		"Mutex":   NewMutex(NewDefaultLimiter),
+		"Bucket":  NewMutex(func() limiter.Limiter { return limiter.NewBucket() }),
+		"RWMutex": NewRWMutex(NewDefaultLimiter),
+		"SyncMap": NewSyncMapLoadOrStore(NewDefaultLimiter),
+		"LRU":     NewLRU(NewDefaultLimiter, LRUOption{MaxKeys: 10}),
+		"Sharded": NewSharded(NewDefaultLimiter, ShardedOption{}),
+		"RedisDelayedSync": NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+			DisableAutoSync: true,
+		}),
+	}
+	for name, rl := range ratelimiters {
+		t.Run(fmt.Sprintf("ratelimiter=%s", name), func(t *testing.T) {
+			// Returning tokens to a fresh key does not hold back its burst
+			if err := rl.ReturnN("a", 1); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok, err := rl.AllowN("a", 10, 0.001, 10); !ok || err != nil {
+				t.Fatalf("expected the burst to be allowed, got ok=%t err=%v", ok, err)
+			}
+			if err := rl.ReturnN("a", 3); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok, _ := rl.AllowN("a", 3, 0.001, 10); !ok {
+				t.Fatalf("expected the returned tokens to be allowed")
+			}
+			if ok, _ := rl.AllowN("a", 1, 0.001, 10); ok {
+				t.Fatalf("expected no more than the returned tokens to be allowed")
+			}
+			if err := rl.ReturnN("a", -1); !errors.Is(err, limiter.ErrNegativeCost) {
+				t.Fatalf("expected ErrNegativeCost, got %v", err)
+			}
+		})
+	}
+	if err := NewMutex(func() limiter.Limiter { return limiter.NewBuiltinLimiter(1, 1) }).ReturnN("a", 1); !errors.Is(err, limiter.ErrReturnNotSupported) {
+		t.Fatalf("expected ErrReturnNotSupported, got %v", err)
+	}
+}
+
+func TestIsolatedGoRedisRateLimit(t *testing.T) {
+	tests := []struct {
+		replenishPerSecond float64
+		rate               int
+		period             time.Duration
+	}{
+		{replenishPerSecond: 100, rate: 100, period: time.Second},
+		{replenishPerSecond: 0.5, rate: 30, period: time.Minute},
+		{replenishPerSecond: 2.5, rate: 150, period: time.Minute},
+		{replenishPerSecond: 0.1, rate: 6, period: time.Minute},
+		{replenishPerSecond: 1.0 / 120, rate: 30, period: time.Hour},
+		{replenishPerSecond: 1.0 / 7, rate: 1, period: 7 * time.Second},
+		{replenishPerSecond: 1.0 / 86400, rate: 1, period: 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("rate=%v", tt.replenishPerSecond), func(t *testing.T) {
+			limit, err := toRedisRateLimit(tt.replenishPerSecond, 10)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if limit.Rate != tt.rate || limit.Period != tt.period || limit.Burst != 10 {
+				t.Fatalf("expected %d per %s, got %d per %s", tt.rate, tt.period, limit.Rate, limit.Period)
+			}
+		})
+	}
+	for _, replenishPerSecond := range []float64{0.123456789, 1.2345678, math.Inf(1)} {
+		if _, err := toRedisRateLimit(replenishPerSecond, 10); !errors.Is(err, ErrUnrepresentableRate) {
+			t.Fatalf("rate=%v: expected ErrUnrepresentableRate, got %v", replenishPerSecond, err)
+		}
+	}
+}
+
+func TestIsolatedAllowNCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rl := NewMutex(NewDefaultLimiter)
+	if ok, err := AllowNCtx(ctx, rl, "a", 1, 1, 1); !ok || err != nil {
+		t.Fatalf("expected allowed, got ok=%t err=%v", ok, err)
+	}
+	cancel()
+	if ok, err := AllowNCtx(ctx, rl, "b", 1, 1, 1); ok || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got ok=%t err=%v", ok, err)
+	}
+	if ok, err := rl.AllowN("b", 1, 1, 1); !ok || err != nil {
+		t.Fatalf("expected the cancelled call not to consume, got ok=%t err=%v", ok, err)
+	}
+	if ok, err := ForceNCtx(ctx, rl, "c", 1, 1, 1); ok || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got ok=%t err=%v", ok, err)
+	}
+	if ok, err := ForceNCtx(context.Background(), rl, "c", 2, 1, 1); !ok || err != nil {
+		t.Fatalf("expected forced, got ok=%t err=%v", ok, err)
+	}
+}
+
+func TestIsolatedForceN(t *testing.T) {
+	ratelimiters := map[string]ForcingRatelimiter{
+		"Mutex":    NewMutex(NewDefaultLimiter),
+		"RWMutex":  NewRWMutex(NewDefaultLimiter),
+		"SyncMap":  NewSyncMapLoadOrStore(NewDefaultLimiter),
+		"LRU":      NewLRU(NewDefaultLimiter, LRUOption{}),
+		"Sharded":  NewSharded(NewDefaultLimiter, ShardedOption{}),
+		"Adaptive": NewAdaptive(NewSharded(NewAIMDLimiterFn(NewDefaultLimiter, limiter.AIMDOption{}), ShardedOption{})),
+		"RedisDelayedSync": NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+			DisableAutoSync: true,
+		}),
+	}
+	for name, rl := range ratelimiters {
+		t.Run(fmt.Sprintf("ratelimiter=%s", name), func(t *testing.T) {
+			// Charging after the fact goes beyond burst
+			if ok, err := rl.ForceN("a", 20, 1, 10); !ok || err != nil {
+				t.Fatalf("expected forced, got ok=%t err=%v", ok, err)
+			}
+			if ok, _ := rl.AllowN("a", 1, 1, 10); ok {
+				t.Fatalf("expected the forced tokens to be accounted")
+			}
+			if ok, err := rl.ForceN("a", -1, 1, 10); ok || !errors.Is(err, limiter.ErrNegativeCost) {
+				t.Fatalf("expected ErrNegativeCost, got ok=%t err=%v", ok, err)
+			}
+		})
+	}
+}
+
 type testRatelimiterConfig struct {
 	reqPerSec float64
 	burst     int
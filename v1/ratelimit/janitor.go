@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+)
+
+// JanitorOption configures the eviction of keys from the in-memory keyed ratelimiters.
+// Eviction is opt-in, without a janitor the keys are kept forever.
+type JanitorOption struct {
+	// Interval is the interval between sweeps, it defaults to IdleTTL or 1 minute if IdleTTL is not set
+	Interval time.Duration
+	// IdleTTL evicts the keys that have not been used for at least IdleTTL, zero disables it
+	// Evicting a key that is not replenished yet gives the key a fresh limiter with a full burst.
+	IdleTTL time.Duration
+	// EvictReplenished evicts the keys whose limiter is back to full burst, see `limiter.Replenisher`
+	// Keys used since the previous sweep are kept even if replenished, a call racing with the eviction itself
+	// may still be applied to the evicted limiter and let one more request through the fresh one.
+	EvictReplenished bool
+	// Clock is the source of time of the sweeps, defaults to `limiter.SystemClock`
+	// Pass the clock given to the limiters so that idle and replenished keys are judged on the same time.
+	Clock limiter.Clock
+}
+
+func (o JanitorOption) interval() time.Duration {
+	if o.Interval > 0 {
+		return o.Interval
+	}
+	if o.IdleTTL > 0 {
+		return o.IdleTTL
+	}
+	return time.Minute
+}
+
+// entry wraps a limiter with the bookkeeping needed by the janitor
+type entry[Limiter limiter.Limiter] struct {
+	limiter Limiter
+	// touched is set on every access and cleared by the janitor
+	touched atomic.Bool
+	// lastSeen is the time of the sweep that last saw the entry touched, in unix nanoseconds
+	lastSeen atomic.Int64
+}
+
+func newEntry[Limiter limiter.Limiter](l Limiter) *entry[Limiter] {
+	e := &entry[Limiter]{limiter: l}
+	e.touched.Store(true)
+	return e
+}
+
+// touch marks the entry as used, the store is skipped when it is already marked to avoid contention on hot keys
+func (e *entry[Limiter]) touch() Limiter {
+	if !e.touched.Load() {
+		e.touched.Store(true)
+	}
+	return e.limiter
+}
+
+// shouldEvict is called by the janitor once per sweep for every entry
+// Note: A call racing with the eviction may be applied to the evicted limiter and be lost
+func (e *entry[Limiter]) shouldEvict(opt JanitorOption, now time.Time) bool {
+	if e.touched.Swap(false) || e.lastSeen.Load() == 0 {
+		// the entry was used since the previous sweep, evicting it now could drop tokens taken by the caller
+		e.lastSeen.Store(now.UnixNano())
+		return false
+	}
+	if opt.IdleTTL > 0 && now.UnixNano()-e.lastSeen.Load() >= opt.IdleTTL.Nanoseconds() {
+		return true
+	}
+	if opt.EvictReplenished {
+		if r, ok := any(e.limiter).(limiter.Replenisher); ok && r.IsReplenished(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// startJanitor calls sweep with the time of opt.Clock every interval until ctx is done
+func startJanitor(ctx context.Context, opt JanitorOption, sweep func(JanitorOption, time.Time)) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	clock := opt.Clock
+	if clock == nil {
+		clock = limiter.SystemClock
+	}
+	go func() {
+		ticker := time.NewTicker(opt.interval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweep(opt, clock.Now())
+			}
+		}
+	}()
+}
@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+)
+
+// AllowNLimit is `Ratelimiter.AllowN` with a `limiter.Limit`, e.g. `limiter.PerMinute(100)`
+func AllowNLimit(r Ratelimiter, key string, cost int, limit limiter.Limit) (bool, error) {
+	return r.AllowN(key, cost, limit.ReplenishPerSecond, limit.Burst)
+}
+
+// AllowNDetailedLimit is `DetailedRatelimiter.AllowNDetailed` with a `limiter.Limit`
+func AllowNDetailedLimit(r DetailedRatelimiter, key string, cost int, limit limiter.Limit) (limiter.Result, error) {
+	return r.AllowNDetailed(key, cost, limit.ReplenishPerSecond, limit.Burst)
+}
+
+// WaitNLimit is `WaitingRatelimiter.WaitN` with a `limiter.Limit`
+func WaitNLimit(ctx context.Context, r WaitingRatelimiter, key string, cost int, limit limiter.Limit) error {
+	return r.WaitN(ctx, key, cost, limit.ReplenishPerSecond, limit.Burst)
+}
+
+// ReserveNLimit is `ReservingRatelimiter.ReserveN` with a `limiter.Limit`
+func ReserveNLimit(r ReservingRatelimiter, key string, cost int, limit limiter.Limit) (*limiter.Reservation, error) {
+	return r.ReserveN(key, cost, limit.ReplenishPerSecond, limit.Burst)
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+)
+
+// DefaultLRUMaxKeys is the number of keys tracked by LRU when `LRUOption.MaxKeys` is not set
+const DefaultLRUMaxKeys = 65536
+
+type LRUOption struct {
+	// MaxKeys is the upper bound on the number of tracked keys, the least recently used key is evicted beyond it
+	// An evicted key comes back with a fresh limiter, which is fully replenished
+	MaxKeys int
+}
+
+// LRU is a keyed ratelimiter with a hard upper bound on the number of tracked keys.
+// It protects the process against key-spraying at the cost of forgetting the least recently used keys.
+type LRU[Limiter limiter.Limiter] struct {
+	mu           sync.Mutex
+	maxKeys      int
+	limiters     map[string]*list.Element
+	order        *list.List
+	newLimiterFn func() Limiter
+}
+
+type lruEntry[Limiter limiter.Limiter] struct {
+	key     string
+	limiter Limiter
+}
+
+var _ WaitingRatelimiter = &LRU[limiter.Limiter]{}
+var _ DetailedRatelimiter = &LRU[limiter.Limiter]{}
+var _ ReservingRatelimiter = &LRU[limiter.Limiter]{}
+var _ ForcingRatelimiter = &LRU[limiter.Limiter]{}
+var _ ReturningRatelimiter = &LRU[limiter.Limiter]{}
+
+func NewLRU[Limiter limiter.Limiter](newLimiterFn func() Limiter, opt LRUOption) *LRU[Limiter] {
+	maxKeys := opt.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = DefaultLRUMaxKeys
+	}
+	return &LRU[Limiter]{
+		maxKeys:      maxKeys,
+		limiters:     make(map[string]*list.Element),
+		order:        list.New(),
+		newLimiterFn: newLimiterFn,
+	}
+}
+
+func (d *LRU[Limiter]) GetLimiter(key string) Limiter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if el, ok := d.limiters[key]; ok {
+		d.order.MoveToFront(el)
+		return el.Value.(*lruEntry[Limiter]).limiter
+	}
+	if d.order.Len() >= d.maxKeys {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.limiters, oldest.Value.(*lruEntry[Limiter]).key)
+	}
+	e := &lruEntry[Limiter]{key: key, limiter: d.newLimiterFn()}
+	d.limiters[key] = d.order.PushFront(e)
+	return e.limiter
+}
+
+// Len returns the number of tracked keys
+func (d *LRU[Limiter]) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.order.Len()
+}
+
+func (d *LRU[Limiter]) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.GetLimiter(key).AllowN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *LRU[Limiter]) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.GetLimiter(key).ForceN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *LRU[Limiter]) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return limiter.Result{}, err
+	}
+	return limiter.AllowNDetailed(d.GetLimiter(key), cost, replenishPerSecond, burst), nil
+}
+
+func (d *LRU[Limiter]) WaitN(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) error {
+	return limiter.WaitN(ctx, d.GetLimiter(key), cost, replenishPerSecond, burst)
+}
+
+// ReserveN reserves the tokens of the key, see `limiter.Limiter.ReserveN`
+func (d *LRU[Limiter]) ReserveN(key string, cost int, replenishPerSecond float64, burst int) (*limiter.Reservation, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return nil, err
+	}
+	return d.GetLimiter(key).ReserveN(cost, replenishPerSecond, burst), nil
+}
+
+// ReturnN gives n tokens back to the limiter of the key, see `limiter.ReturnN`
+func (d *LRU[Limiter]) ReturnN(key string, n int) error {
+	return limiter.ReturnN(d.GetLimiter(key), n)
+}
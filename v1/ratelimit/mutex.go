@@ -1,71 +1,181 @@
 package ratelimit
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/yesyoukenspace/go-ratelimit/limiter"
 )
 
 type Mutex[Limiter limiter.Limiter] struct {
 	mu           sync.Mutex
-	limiters     map[string]Limiter
+	limiters     map[string]*entry[Limiter]
 	newLimiterFn func() Limiter
 }
 
-var _ Ratelimiter = &Mutex[limiter.Limiter]{}
+var _ WaitingRatelimiter = &Mutex[limiter.Limiter]{}
+var _ DetailedRatelimiter = &Mutex[limiter.Limiter]{}
+var _ ReservingRatelimiter = &Mutex[limiter.Limiter]{}
+var _ ForcingRatelimiter = &Mutex[limiter.Limiter]{}
+var _ ReturningRatelimiter = &Mutex[limiter.Limiter]{}
 
 func NewMutex[Limiter limiter.Limiter](newLimiterFn func() Limiter) *Mutex[Limiter] {
 	return &Mutex[Limiter]{
-		limiters:     make(map[string]Limiter),
+		limiters:     make(map[string]*entry[Limiter]),
 		newLimiterFn: newLimiterFn,
 	}
 }
 
-func (d *Mutex[Limiter]) getLimiter(key string) Limiter {
+func (d *Mutex[Limiter]) GetLimiter(key string) Limiter {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	l, ok := d.limiters[key]
+	e, ok := d.limiters[key]
 	if !ok {
-		l = d.newLimiterFn()
-		d.limiters[key] = l
+		e = newEntry(d.newLimiterFn())
+		d.limiters[key] = e
 	}
-	return l
+	return e.touch()
 }
 
 func (d *Mutex[Limiter]) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
-	l := d.getLimiter(key)
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	l := d.GetLimiter(key)
 	return l.AllowN(cost, replenishPerSecond, burst), nil
 }
 
+func (d *Mutex[Limiter]) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.GetLimiter(key).ForceN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *Mutex[Limiter]) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return limiter.Result{}, err
+	}
+	return limiter.AllowNDetailed(d.GetLimiter(key), cost, replenishPerSecond, burst), nil
+}
+
+func (d *Mutex[Limiter]) WaitN(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) error {
+	return limiter.WaitN(ctx, d.GetLimiter(key), cost, replenishPerSecond, burst)
+}
+
+// ReserveN reserves the tokens of the key, see `limiter.Limiter.ReserveN`
+func (d *Mutex[Limiter]) ReserveN(key string, cost int, replenishPerSecond float64, burst int) (*limiter.Reservation, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return nil, err
+	}
+	return d.GetLimiter(key).ReserveN(cost, replenishPerSecond, burst), nil
+}
+
+// ReturnN gives n tokens back to the limiter of the key, see `limiter.ReturnN`
+func (d *Mutex[Limiter]) ReturnN(key string, n int) error {
+	return limiter.ReturnN(d.GetLimiter(key), n)
+}
+
+// StartJanitor evicts keys according to opt until ctx is done
+func (d *Mutex[Limiter]) StartJanitor(ctx context.Context, opt JanitorOption) {
+	startJanitor(ctx, opt, d.sweep)
+}
+
+func (d *Mutex[Limiter]) sweep(opt JanitorOption, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, e := range d.limiters {
+		if e.shouldEvict(opt, now) {
+			delete(d.limiters, key)
+		}
+	}
+}
+
 type RWMutex[Limiter limiter.Limiter] struct {
 	mu           sync.RWMutex
-	limiters     map[string]Limiter
+	limiters     map[string]*entry[Limiter]
 	newLimiterFn func() Limiter
 }
 
+var _ WaitingRatelimiter = &RWMutex[limiter.Limiter]{}
+var _ DetailedRatelimiter = &RWMutex[limiter.Limiter]{}
+var _ ReservingRatelimiter = &RWMutex[limiter.Limiter]{}
+var _ ForcingRatelimiter = &RWMutex[limiter.Limiter]{}
+var _ ReturningRatelimiter = &RWMutex[limiter.Limiter]{}
+
 func NewRWMutex[Limiter limiter.Limiter](newLimiterFn func() Limiter) *RWMutex[Limiter] {
 	return &RWMutex[Limiter]{
-		limiters:     make(map[string]Limiter),
+		limiters:     make(map[string]*entry[Limiter]),
 		newLimiterFn: newLimiterFn,
 	}
 }
 
-func (d *RWMutex[Limiter]) getLimiter(key string) limiter.Limiter {
+func (d *RWMutex[Limiter]) GetLimiter(key string) Limiter {
 	d.mu.RLock()
-	l, ok := d.limiters[key]
+	e, ok := d.limiters[key]
 	d.mu.RUnlock()
 	if !ok {
 		d.mu.Lock()
-		if l, ok = d.limiters[key]; !ok {
-			l = d.newLimiterFn()
-			d.limiters[key] = l
+		if e, ok = d.limiters[key]; !ok {
+			e = newEntry(d.newLimiterFn())
+			d.limiters[key] = e
 		}
 		d.mu.Unlock()
 	}
-	return l
+	return e.touch()
 }
 
 func (d *RWMutex[Limiter]) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
-	l := d.getLimiter(key)
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	l := d.GetLimiter(key)
 	return l.AllowN(cost, replenishPerSecond, burst), nil
 }
+
+func (d *RWMutex[Limiter]) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.GetLimiter(key).ForceN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *RWMutex[Limiter]) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return limiter.Result{}, err
+	}
+	return limiter.AllowNDetailed(d.GetLimiter(key), cost, replenishPerSecond, burst), nil
+}
+
+func (d *RWMutex[Limiter]) WaitN(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) error {
+	return limiter.WaitN(ctx, d.GetLimiter(key), cost, replenishPerSecond, burst)
+}
+
+// ReserveN reserves the tokens of the key, see `limiter.Limiter.ReserveN`
+func (d *RWMutex[Limiter]) ReserveN(key string, cost int, replenishPerSecond float64, burst int) (*limiter.Reservation, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return nil, err
+	}
+	return d.GetLimiter(key).ReserveN(cost, replenishPerSecond, burst), nil
+}
+
+// ReturnN gives n tokens back to the limiter of the key, see `limiter.ReturnN`
+func (d *RWMutex[Limiter]) ReturnN(key string, n int) error {
+	return limiter.ReturnN(d.GetLimiter(key), n)
+}
+
+// StartJanitor evicts keys according to opt until ctx is done
+func (d *RWMutex[Limiter]) StartJanitor(ctx context.Context, opt JanitorOption) {
+	startJanitor(ctx, opt, d.sweep)
+}
+
+func (d *RWMutex[Limiter]) sweep(opt JanitorOption, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, e := range d.limiters {
+		if e.shouldEvict(opt, now) {
+			delete(d.limiters, key)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+)
+
+// DefaultRedisConcurrencyLeaseTTL is the lease TTL used when `RedisConcurrencyOption.LeaseTTL` is not set
+const DefaultRedisConcurrencyLeaseTTL = time.Minute
+
+// acquireScript removes the expired leases and adds one member per slot, scored by the expiry of the lease.
+// The time of the redis server is used so that the clocks of the servers do not matter.
+var acquireScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local n = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) + n > limit then
+	return 0
+end
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], now + ttl, ARGV[4] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+return 1
+`)
+
+type RedisConcurrencyOption struct {
+	// RedisClient is any `redis.UniversalClient`, the slots of a key are held in that key only so it needs no hash tag on a cluster
+	RedisClient redis.UniversalClient
+	// LeaseTTL is how long the slots are held if they are not released, e.g. when the holder crashes
+	// It should be longer than the work being limited, defaults to `DefaultRedisConcurrencyLeaseTTL`
+	LeaseTTL time.Duration
+}
+
+// RedisConcurrency is a distributed in-flight limiter.
+// The slots of a key are leases in a redis sorted set, a lease expires after the lease TTL so crashed holders do not leak slots.
+type RedisConcurrency struct {
+	ctx         context.Context
+	redisClient redis.UniversalClient
+	leaseTTL    time.Duration
+}
+
+var _ ConcurrencyLimiter = &RedisConcurrency{}
+
+func NewRedisConcurrency(ctx context.Context, opt RedisConcurrencyOption) *RedisConcurrency {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	leaseTTL := opt.LeaseTTL
+	if leaseTTL <= 0 {
+		leaseTTL = DefaultRedisConcurrencyLeaseTTL
+	}
+	return &RedisConcurrency{
+		ctx:         ctx,
+		redisClient: opt.RedisClient,
+		leaseTTL:    leaseTTL,
+	}
+}
+
+func (r *RedisConcurrency) AcquireN(key string, n int, limit int) (func() error, bool, error) {
+	return r.AcquireNCtx(r.ctx, key, n, limit)
+}
+
+// AcquireNCtx is AcquireN with the acquiring redis call bound to ctx, e.g. to the deadline of the request.
+// release uses ctx without its cancellation, so that the slots can be given back after ctx is done while keeping its values, e.g. the tracing span.
+func (r *RedisConcurrency) AcquireNCtx(ctx context.Context, key string, n int, limit int) (func() error, bool, error) {
+	if n < 0 {
+		return nil, false, fmt.Errorf("%w: n=%d", limiter.ErrNegativeCost, n)
+	}
+	if n > limit {
+		return nil, false, nil
+	}
+	id, err := newLeaseID()
+	if err != nil {
+		return nil, false, err
+	}
+	acquired, err := acquireScript.Run(ctx, r.redisClient, []string{key}, n, limit, r.leaseTTL.Milliseconds(), id).Int()
+	if err != nil || acquired == 0 {
+		return nil, false, err
+	}
+	releaseCtx := context.WithoutCancel(ctx)
+	var once sync.Once
+	var releaseErr error
+	return func() error {
+		once.Do(func() {
+			// No lease member was added for 0 slots, and ZREM takes at least one
+			if n == 0 {
+				return
+			}
+			members := make([]any, n)
+			for i := range members {
+				members[i] = id + ":" + strconv.Itoa(i+1)
+			}
+			releaseErr = r.redisClient.ZRem(releaseCtx, key, members...).Err()
+		})
+		return releaseErr
+	}, true, nil
+}
+
+// InFlight returns the number of slots of the key held by leases that have not expired
+func (r *RedisConcurrency) InFlight(key string) (int, error) {
+	return r.InFlightCtx(r.ctx, key)
+}
+
+// InFlightCtx is InFlight with the redis calls bound to ctx
+func (r *RedisConcurrency) InFlightCtx(ctx context.Context, key string) (int, error) {
+	now, err := r.redisClient.Time(ctx).Result()
+	if err != nil {
+		return 0, err
+	}
+	count, err := r.redisClient.ZCount(ctx, key, "("+strconv.FormatInt(now.UnixMilli(), 10), "+inf").Result()
+	return int(count), err
+}
+
+func newLeaseID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -2,15 +2,21 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/yesyoukenspace/go-ratelimit/limiter"
 )
 
+// DefaultRedisDelayedSyncBatchSize is the number of keys synced per pipeline when `RedisDelayedSyncOption.SyncBatchSize` is not set
+const DefaultRedisDelayedSyncBatchSize = 500
+
 type RedisDelayedSyncCorruptedRemotePolicy string
 
 const (
@@ -27,27 +33,161 @@ const (
 	RedisDelayedSyncCorruptedRemotePolicyReset RedisDelayedSyncCorruptedRemotePolicy = "RESET"
 )
 
+// ErrClosed is returned by the calls made to a `RedisDelayedSync` after Close
+var ErrClosed = errors.New("ratelimit: closed")
+
+// RedisDelayedSyncPhase is the step of the sync of a key that failed, see `RedisDelayedSyncError`
+type RedisDelayedSyncPhase string
+
+const (
+	// SCRIPT: the sync script did not run, e.g. redis is unreachable, or failed in redis, e.g. the key holds a non-integer value
+	// The delta of the key is kept and pushed by the next sync.
+	RedisDelayedSyncPhaseScript RedisDelayedSyncPhase = "SCRIPT"
+	// APPLY: the reply of the sync script could not be applied to the local limiter, e.g. a non-integer remote value
+	RedisDelayedSyncPhaseApply RedisDelayedSyncPhase = "APPLY"
+	// RECOVERY: the corrupted remote of the key could not be recovered, e.g. the `RedisDelayedSyncCorruptedRemotePolicy` is invalid
+	RedisDelayedSyncPhaseRecovery RedisDelayedSyncPhase = "RECOVERY"
+)
+
+// RedisDelayedSyncError is the failure to sync a key, `RedisDelayedSyncOption.SyncErrorHandler` gets one per key that failed
+type RedisDelayedSyncError struct {
+	Key   string
+	Phase RedisDelayedSyncPhase
+	Err   error
+}
+
+func (e *RedisDelayedSyncError) Error() string {
+	return fmt.Sprintf("ratelimit: failed to sync key %q in phase %s: %v", e.Key, e.Phase, e.Err)
+}
+
+func (e *RedisDelayedSyncError) Unwrap() error {
+	return e.Err
+}
+
+// syncScript syncs a key atomically, so no other server can push to the key between the steps of the sync or the recovery of a corrupted remote.
+// It takes KEYS[1] the key and KEYS[2] its returnedKey, and ARGV resetAt, delta, lastSynced, lastSyncedReturned, the corrupted remote policy and the expiry in milliseconds, 0 for none.
+// It returns the outcome, one of "set", "missing", "synced" or "corrupted", the remote value and the value of the returnedKey.
+// The values are nanoseconds beyond the 2^53 of the Lua numbers, so they are kept as strings and only their differences are computed, by sub.
+var syncScript = redis.NewScript(`
+local function parts(a)
+	local sign = 1
+	if a:sub(1, 1) == '-' then
+		sign, a = -1, a:sub(2)
+	end
+	return sign * (tonumber(a:sub(1, -10)) or 0), sign * tonumber(a:sub(-9))
+end
+
+-- sub is a - b, exact as long as the difference fits the 2^53 of the Lua numbers
+local function sub(a, b)
+	local a_high, a_low = parts(a)
+	local b_high, b_low = parts(b)
+	return (a_high - b_high) * 1e9 + (a_low - b_low)
+end
+
+local key, returned_key = KEYS[1], KEYS[2]
+local reset_at, delta, last_synced, last_synced_returned, policy, expire_in = ARGV[1], ARGV[2], ARGV[3], ARGV[4], ARGV[5], ARGV[6]
+
+-- push adds the delta to the key, a negative delta gives back the tokens returned since the last sync,
+-- they are counted in the returnedKey so that the other servers do not take the drop of the key for a corrupted remote
+local function push()
+	if delta:sub(1, 1) == '-' then
+		redis.call('INCRBY', returned_key, delta:sub(2))
+	end
+	redis.call('INCRBY', key, delta)
+end
+
+if last_synced == '0' then
+	-- NX so that the key set by another server is not overwritten
+	if sub(reset_at, '0') > 0 and redis.call('SET', key, reset_at, 'NX') then
+		-- The tokens returned before the key is set are part of resetAt, only the returned tokens from now on count
+		return {'set', reset_at, redis.call('GET', returned_key) or '0'}
+	end
+	if delta ~= '0' then
+		push()
+	end
+	local remote = redis.call('GET', key)
+	if not remote then
+		return {'missing', '0', '0'}
+	end
+	return {'synced', remote, redis.call('GET', returned_key) or '0'}
+end
+
+local remote = redis.call('GET', key)
+local returned = redis.call('GET', returned_key) or '0'
+-- A returnedKey lower than at the last sync was lost, the tokens returned since then are not counted
+local returned_by_others = math.max(sub(returned, last_synced_returned), 0)
+-- The key only drops by the tokens the other servers returned, a drop by more than that is a corrupted remote, however large the burst is
+if not remote or sub(remote, last_synced) < -returned_by_others then
+	-- The delta is not pushed, the server adds it back and pushes it on the next sync
+	if policy == 'UPLOAD_LOCAL' then
+		redis.call('SET', key, last_synced)
+	end
+	return {'corrupted', remote or '0', returned}
+end
+if delta ~= '0' then
+	push()
+	remote = redis.call('GET', key)
+	returned = redis.call('GET', returned_key) or '0'
+elseif expire_in ~= '0' and remote == last_synced then
+	redis.call('PEXPIRE', key, expire_in, 'NX')
+	redis.call('PEXPIRE', returned_key, expire_in, 'NX')
+end
+return {'synced', remote, returned}
+`)
+
+var _ WaitingRatelimiter = &RedisDelayedSync{}
+var _ DetailedRatelimiter = &RedisDelayedSync{}
+var _ ReservingRatelimiter = &RedisDelayedSync{}
+var _ ReturningRatelimiter = &RedisDelayedSync{}
+var _ ContextRatelimiter = &RedisDelayedSync{}
+var _ ForcingRatelimiter = &RedisDelayedSync{}
+var _ ContextForcingRatelimiter = &RedisDelayedSync{}
+
 type RedisDelayedSync struct {
-	syncInterval          time.Duration
-	ctx                   context.Context
-	cancel                context.CancelFunc
-	inner                 *SyncMapLoadThenLoadOrStore[*limiter.ResetBasedLimiter]
-	redisClient           *redis.Client
-	lastSyncedResetAt     sync.Map
+	syncInterval      time.Duration
+	ctx               context.Context
+	cancel            context.CancelFunc
+	inner             *SyncMapLoadThenLoadOrStore[limiter.SyncableLimiter]
+	redisClient       redis.UniversalClient
+	lastSyncedResetAt sync.Map
+	// lastSyncedReturned is the value of the returnedKey of a key at its last sync
+	lastSyncedReturned    sync.Map
 	syncErrorHandler      func(error)
 	keyExpiry             time.Duration
 	corruptedRemotePolicy RedisDelayedSyncCorruptedRemotePolicy
+	clock                 limiter.Clock
+	syncBatchSize         int
+	// autoSyncLoops tracks the loops started by StartAutoSyncLoop so that Close can wait for them before the final flush
+	autoSyncLoops sync.WaitGroup
+	stopAutoSync  chan struct{}
+	closed        atomic.Bool
+	// closeMu orders the start of the auto sync loops with the Wait of Close, no loop is started once closed is set
+	closeMu sync.Mutex
+	// closing serializes the calls to Close, flushed is set once one of them has flushed every key
+	closing chan struct{}
+	flushed bool
 }
 
 type RedisDelayedSyncOption struct {
 	// SyncInterval is the interval to sync the rate limit to the redis
 	// Adjust this value to trade off between the performance and the accuracy of the rate limit
-	SyncInterval          time.Duration
-	RedisClient           *redis.Client
+	SyncInterval time.Duration
+	// RedisClient is any of `*redis.Client`, `*redis.ClusterClient`, `*redis.Ring` or a failover client.
+	// A sync touches the key of the ratelimiter and its returnedKey kept in the same slot, so the keys need no hash tag on a cluster.
+	RedisClient redis.UniversalClient
+	// SyncErrorHandler is called with a `*RedisDelayedSyncError` for every key that failed to sync, the other keys are synced regardless
 	SyncErrorHandler      func(error)
 	KeyExpiry             time.Duration
 	DisableAutoSync       bool
 	CorruptedRemotePolicy RedisDelayedSyncCorruptedRemotePolicy
+	// Clock is the source of time of the local limiters and of the key expiry, defaults to `limiter.SystemClock`
+	Clock limiter.Clock
+	// NewSyncableLimiterFn creates the local limiter of a key, defaults to `limiter.NewResetbasedLimiterWithClock`
+	// Use `limiter.NewSlidingWindowCounterWithClock` to enforce limits documented as sliding window counters
+	NewSyncableLimiterFn func(limiter.Clock) limiter.SyncableLimiter
+	// SyncBatchSize is the number of keys synced together in redis pipelines, a batch costs a single round trip whatever its size
+	// Defaults to `DefaultRedisDelayedSyncBatchSize`
+	SyncBatchSize int
 }
 
 func NewRedisDelayedSync(ctx context.Context, opt RedisDelayedSyncOption) *RedisDelayedSync {
@@ -61,16 +201,41 @@ func NewRedisDelayedSync(ctx context.Context, opt RedisDelayedSyncOption) *Redis
 		corruptedRemotePolicy = opt.CorruptedRemotePolicy
 	}
 
+	clock := opt.Clock
+	if clock == nil {
+		clock = limiter.SystemClock
+	}
+
+	newSyncableLimiterFn := opt.NewSyncableLimiterFn
+	if newSyncableLimiterFn == nil {
+		newSyncableLimiterFn = func(clock limiter.Clock) limiter.SyncableLimiter {
+			return limiter.NewResetbasedLimiterWithClock(clock)
+		}
+	}
+	newLimiterFn := func() limiter.SyncableLimiter {
+		return newSyncableLimiterFn(clock)
+	}
+
+	syncBatchSize := opt.SyncBatchSize
+	if syncBatchSize <= 0 {
+		syncBatchSize = DefaultRedisDelayedSyncBatchSize
+	}
+
 	rl := &RedisDelayedSync{
 		ctx:                   ctx,
 		cancel:                cancel,
 		redisClient:           opt.RedisClient,
 		syncInterval:          opt.SyncInterval,
-		inner:                 NewSyncMapLoadThenLoadOrStore(limiter.NewResetbasedLimiter),
+		inner:                 NewSyncMapLoadThenLoadOrStore(newLimiterFn),
 		lastSyncedResetAt:     sync.Map{},
+		lastSyncedReturned:    sync.Map{},
 		syncErrorHandler:      opt.SyncErrorHandler,
 		keyExpiry:             opt.KeyExpiry,
 		corruptedRemotePolicy: corruptedRemotePolicy,
+		clock:                 clock,
+		syncBatchSize:         syncBatchSize,
+		stopAutoSync:          make(chan struct{}),
+		closing:               make(chan struct{}, 1),
 	}
 	if rl.syncErrorHandler == nil {
 		rl.syncErrorHandler = func(err error) {
@@ -84,27 +249,80 @@ func NewRedisDelayedSync(ctx context.Context, opt RedisDelayedSyncOption) *Redis
 }
 
 func (r *RedisDelayedSync) StartAutoSyncLoop() {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+	if r.closed.Load() {
+		return
+	}
+	r.autoSyncLoops.Add(1)
 	go func() {
+		defer r.autoSyncLoops.Done()
 		ticker := time.NewTicker(r.syncInterval)
 		for {
 			select {
 			case <-r.ctx.Done():
 				ticker.Stop()
 				return
+			case <-r.stopAutoSync:
+				// The sync in progress, if any, is not interrupted so that its deltas are not lost
+				ticker.Stop()
+				return
 			case <-ticker.C:
 				// Avoid overlapping calls to this function
 				// We want syncAll to be called at most once at any given time thus we are not using a goroutine here
-				if err := r.syncAll(); err != nil {
-					if r.syncErrorHandler != nil {
-						r.syncErrorHandler(err)
-					}
-				}
+				// The errors are already reported to syncErrorHandler key by key
+				_ = r.syncAll(r.ctx)
 			}
 		}
 	}()
 }
 
+// Close stops the auto sync loop and flushes the deltas of every key to redis, e.g. on the shutdown of a rolling deploy,
+// so that the consumption of this server is not given back to the users as extra quota.
+// The flush is bound to ctx, it returns the errors of the keys that could not be flushed, see `RedisDelayedSyncError`.
+// If ctx is done before every key is flushed, Close returns the error of ctx and can be called again to flush the keys left.
+// The calls made after Close return ErrClosed, the calls made during Close may not be flushed.
+// Close returns ErrClosed once the flush is done.
+func (r *RedisDelayedSync) Close(ctx context.Context) error {
+	select {
+	case r.closing <- struct{}{}:
+		defer func() { <-r.closing }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if r.flushed {
+		return ErrClosed
+	}
+	r.closeMu.Lock()
+	if r.closed.CompareAndSwap(false, true) {
+		close(r.stopAutoSync)
+	}
+	r.closeMu.Unlock()
+	// Wait for the sync in progress to finish, syncAll must not overlap
+	stopped := make(chan struct{})
+	go func() {
+		r.autoSyncLoops.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		// The sync in progress is left to finish with the constructor ctx, a later Close flushes after it
+		return ctx.Err()
+	}
+	err := r.syncAll(ctx)
+	if ctx.Err() == nil {
+		// No loop runs and every key is flushed, nothing uses the constructor ctx anymore
+		r.flushed = true
+		r.cancel()
+	}
+	return err
+}
+
 func (r *RedisDelayedSync) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if r.closed.Load() {
+		return false, ErrClosed
+	}
 	// Optimizations attempted here:
 	// 1. Load Then LoadOrStore takes longer than just simply LoadOrStore, it may be due to us not using the returned value and there are compiler optimizations
 	// 2. Using go routine with LoadOrStore ends up causing more allocations per operation and slowing down this operation
@@ -113,142 +331,325 @@ func (r *RedisDelayedSync) AllowN(key string, cost int, replenishPerSecond float
 }
 
 func (r *RedisDelayedSync) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if r.closed.Load() {
+		return false, ErrClosed
+	}
 	// See AllowN for the optimizations attempted here
 	_, _ = r.lastSyncedResetAt.LoadOrStore(key, 0)
 	return r.inner.ForceN(key, cost, replenishPerSecond, burst)
 }
 
+// AllowNCtx is AllowN that returns the error of ctx if it is done.
+// The decision is local so no redis call is made, the deltas are pushed by the sync with the ctx of the sync.
+func (r *RedisDelayedSync) AllowNCtx(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.AllowN(key, cost, replenishPerSecond, burst)
+}
+
+// ForceNCtx is ForceN that returns the error of ctx if it is done, see AllowNCtx
+func (r *RedisDelayedSync) ForceNCtx(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.ForceN(key, cost, replenishPerSecond, burst)
+}
+
+// AllowNDetailed is AllowN that also reports the state of the local limiter of the key
+func (r *RedisDelayedSync) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if r.closed.Load() {
+		return limiter.Result{}, ErrClosed
+	}
+	// See AllowN for the optimizations attempted here
+	_, _ = r.lastSyncedResetAt.LoadOrStore(key, 0)
+	return r.inner.AllowNDetailed(key, cost, replenishPerSecond, burst)
+}
+
+// WaitN blocks until the local limiter of the key permits the tokens, see `limiter.WaitN`
+// The wait is computed from the local state, deltas from other servers are applied on the next sync.
+func (r *RedisDelayedSync) WaitN(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+	// See AllowN for the optimizations attempted here
+	_, _ = r.lastSyncedResetAt.LoadOrStore(key, 0)
+	return r.inner.WaitN(ctx, key, cost, replenishPerSecond, burst)
+}
+
+// ReserveN reserves the tokens of the key in the local limiter, see `limiter.Limiter.ReserveN`
+// A cancelled reservation is taken out of the delta pushed on the next sync.
+func (r *RedisDelayedSync) ReserveN(key string, cost int, replenishPerSecond float64, burst int) (*limiter.Reservation, error) {
+	if r.closed.Load() {
+		return nil, ErrClosed
+	}
+	// See AllowN for the optimizations attempted here
+	_, _ = r.lastSyncedResetAt.LoadOrStore(key, 0)
+	return r.inner.ReserveN(key, cost, replenishPerSecond, burst)
+}
+
+// ReturnN gives n tokens back to the local limiter of the key, see `limiter.ReturnN`
+// The tokens are taken out of the delta pushed on the next sync, a negative delta gives them back to the other servers
+// and is counted in the returnedKey of the key so that the other servers do not take it for a corrupted remote.
+func (r *RedisDelayedSync) ReturnN(key string, n int) error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+	// See AllowN for the optimizations attempted here
+	_, _ = r.lastSyncedResetAt.LoadOrStore(key, 0)
+	return r.inner.ReturnN(key, n)
+}
+
+// syncAll syncs every key, a key that fails is reported to syncErrorHandler and does not stop the sync of the others.
+// It returns the errors of the keys that failed joined together.
 // Note: This function is not thread safe
 // Avoid overlapping calls to this function
-func (r *RedisDelayedSync) syncAll() error {
+func (r *RedisDelayedSync) syncAll(ctx context.Context) error {
 	// -1 means no expiry
 	expiry := int64(-1)
 	// If the key expiry is set, use it to calculate the expiry time
 	if r.keyExpiry > 0 {
-		expiry = time.Now().Add(-r.keyExpiry).UnixNano()
+		expiry = r.clock.Now().Add(-r.keyExpiry).UnixNano()
 	}
 	// Consider using a different approach to prioritize syncing the keys that are used more frequently
+	keys := make([]string, 0, r.syncBatchSize)
+	var errs []error
+	// Once ctx is done, the keys left are not synced so that they keep their deltas for the next sync, e.g. of a later Close
+	var ctxErr error
+	syncKeys := func() {
+		if ctxErr = ctx.Err(); ctxErr == nil {
+			errs = append(errs, r.syncBatch(ctx, keys, expiry)...)
+		}
+		keys = keys[:0]
+	}
 	r.lastSyncedResetAt.Range(func(key, value any) bool {
-		keyAsString := key.(string)
-		err := r.sync(keyAsString, expiry)
-		if err != nil {
-			r.syncErrorHandler(err)
-			return false
+		keys = append(keys, key.(string))
+		if len(keys) < r.syncBatchSize {
+			return true
 		}
-		return true
+		syncKeys()
+		return ctxErr == nil
 	})
-	return nil
+	if len(keys) > 0 {
+		syncKeys()
+	}
+	for _, err := range errs {
+		r.syncErrorHandler(err)
+	}
+	return errors.Join(append(errs, ctxErr)...)
 }
 
-func (r *RedisDelayedSync) executeCorruptedRemoteRecovery(key string, limiter *limiter.ResetBasedLimiter, delta int64, lastSynced int64) error {
-	switch r.corruptedRemotePolicy {
-	case RedisDelayedSyncCorruptedRemotePolicyUploadLocal:
-		cmd := r.redisClient.Set(r.ctx, key, lastSynced, 0)
-		if cmd.Err() != nil {
-			return cmd.Err()
-		}
-	case RedisDelayedSyncCorruptedRemotePolicyReset:
-		r.lastSyncedResetAt.Store(key, 0)
-	default:
-		return fmt.Errorf("invalid corrupted remote policy: %s", r.corruptedRemotePolicy)
-	}
+// keySync is the state of a key through syncBatch
+type keySync struct {
+	key             string
+	limiter         limiter.SyncableLimiter
+	resetAt         int64
+	delta           int64
+	lastSynced      int64
+	hasSyncedBefore bool
+	keys            []string
+	args            []any
+	cmd             *redis.Cmd
+	done            bool
+	err             error
+}
 
-	// We need to add the delta back to the limiter and wait for the next sync.
-	// We could have done SET lastSynced + delta but it would result in a race condition
-	// where multiple servers could be setting the key at the same time and overwriting each other local delta.
-	limiter.AddDeltaSinceLastPop(delta)
-	return nil
+// Note: This function is not thread safe
+func (r *RedisDelayedSync) sync(ctx context.Context, key string, expiry int64) error {
+	return errors.Join(r.syncBatch(ctx, []string{key}, expiry)...)
 }
 
+// syncBatch runs syncScript for every key in a single pipelined round trip whatever the number of keys,
+// plus one to send the script if redis does not have it cached yet.
+// It returns a `*RedisDelayedSyncError` for every key that failed, the other keys are synced regardless.
 // Note: This function is not thread safe
-func (r *RedisDelayedSync) sync(key string, expiry int64) error {
-	limiter := r.inner.GetLimiter(key)
-	resetAt := limiter.GetResetAt()
-	delta := limiter.PopResetAtDelta()
-	lastSynced, hasLastSynced := r.lastSyncedResetAt.Load(key)
-	hasSyncedBefore := hasLastSynced && lastSynced != 0
-	// Case: Key's first sync
-	if !hasSyncedBefore && resetAt > 0 {
-		// we use `NX` to avoid overwriting the key if it is set by another server
-		cmd := r.redisClient.SetNX(r.ctx, key, resetAt, 0)
-		if cmd.Err() != nil {
-			return cmd.Err()
+func (r *RedisDelayedSync) syncBatch(ctx context.Context, keys []string, expiry int64) []error {
+	now := r.clock.Now()
+	batch := make([]keySync, len(keys))
+	for i, key := range keys {
+		l := r.inner.GetLimiter(key)
+		s := &batch[i]
+		s.key, s.limiter = key, l
+		s.resetAt = l.GetResetAt()
+		s.delta = l.PopResetAtDelta()
+		// Keys that are not synced yet hold an untyped 0
+		if lastSynced, ok := r.lastSyncedResetAt.Load(key); ok {
+			s.lastSynced, _ = lastSynced.(int64)
 		}
-		// Case: The key is set by this server
-		if cmd.Val() {
-			r.lastSyncedResetAt.Store(key, resetAt)
-			return nil
+		s.hasSyncedBefore = s.lastSynced != 0
+		lastSyncedReturned := int64(0)
+		if returned, ok := r.lastSyncedReturned.Load(key); ok {
+			lastSyncedReturned, _ = returned.(int64)
 		}
-		// if the key is not set by this server, we continue to the next step
+		// 0 means no expiry, the key is only expired if it is not incremented by another server, see syncScript
+		expireIn := int64(0)
+		if s.resetAt < expiry && s.delta == 0 {
+			expireIn = max(max(r.keyExpiry, time.Unix(0, s.lastSynced).Sub(now)).Milliseconds(), 1)
+		}
+		s.keys = []string{key, returnedKey(key)}
+		s.args = []any{s.resetAt, s.delta, s.lastSynced, lastSyncedReturned, string(r.corruptedRemotePolicy), expireIn}
 	}
 
-	// In this bloc, we are getting the remote value from redis and pushing the delta if any
-	var remoteValue int64
-	if delta > 0 {
-		// Pushing delta to redis
-		cmd := r.redisClient.IncrBy(r.ctx, key, delta)
-		if cmd.Err() != nil {
-			return cmd.Err()
+	r.pipelined(ctx, batch, func(pipe redis.Pipeliner, s *keySync) {
+		s.cmd = syncScript.EvalSha(ctx, pipe, s.keys, s.args...)
+	})
+	// The script is not cached yet, e.g. on the first sync or after a restart of redis, EVAL caches it for the next syncs
+	for i := range batch {
+		batch[i].done = !redis.HasErrorPrefix(batch[i].cmd.Err(), "NOSCRIPT")
+	}
+	r.pipelined(ctx, batch, func(pipe redis.Pipeliner, s *keySync) {
+		s.cmd = syncScript.Eval(ctx, pipe, s.keys, s.args...)
+	})
+
+	var errs []error
+	for i := range batch {
+		s := &batch[i]
+		if err := s.cmd.Err(); err != nil {
+			// The delta may not have been pushed, e.g. on a dial error or when ctx is done, it is added back for the next sync.
+			// A script that ran but whose reply was lost pushes it twice, which over-counts rather than loses the tokens.
+			s.limiter.AddDeltaSinceLastPop(s.delta)
+			s.err = &RedisDelayedSyncError{Key: s.key, Phase: RedisDelayedSyncPhaseScript, Err: err}
+		} else {
+			s.err = r.applyRemote(s, expiry)
 		}
-		remoteValue = cmd.Val()
-	} else {
-		cmd := r.redisClient.Get(r.ctx, key)
-		if cmd.Err() == redis.Nil {
-			if hasSyncedBefore {
-				return r.executeCorruptedRemoteRecovery(key, limiter, delta, lastSynced.(int64))
-			}
-			return nil
+		if s.err != nil {
+			errs = append(errs, s.err)
 		}
-		if cmd.Err() != nil {
-			return cmd.Err()
+	}
+	return errs
+}
+
+// pipelined queues the commands of the keys that are not done in a single pipeline, no round trip is made if there are none.
+// The errors are read from the commands of every key.
+func (r *RedisDelayedSync) pipelined(ctx context.Context, batch []keySync, queue func(redis.Pipeliner, *keySync)) {
+	pipe := r.redisClient.Pipeline()
+	for i := range batch {
+		if !batch[i].done {
+			queue(pipe, &batch[i])
 		}
-		var err error
-		remoteValue, err = strconv.ParseInt(cmd.Val(), 10, 64)
-		if err != nil {
-			return err
+	}
+	if pipe.Len() == 0 {
+		return
+	}
+	cmds, err := pipe.Exec(ctx)
+	var redisErr redis.Error
+	if err == nil || errors.As(err, &redisErr) {
+		return
+	}
+	// The commands are left without an error when the connection fails, e.g. on a dial error
+	for _, cmd := range cmds {
+		if cmd.Err() == nil {
+			cmd.SetErr(err)
+		}
+	}
+}
+
+// applyRemote reconciles the local limiter of the key with the outcome of syncScript
+func (r *RedisDelayedSync) applyRemote(s *keySync, expiry int64) error {
+	reply, err := s.cmd.StringSlice()
+	if err != nil {
+		return &RedisDelayedSyncError{Key: s.key, Phase: RedisDelayedSyncPhaseApply, Err: err}
+	}
+	if len(reply) != 3 {
+		return &RedisDelayedSyncError{Key: s.key, Phase: RedisDelayedSyncPhaseApply, Err: fmt.Errorf("unexpected sync script reply: %v", reply)}
+	}
+	remoteReturned, err := strconv.ParseInt(reply[2], 10, 64)
+	if err != nil {
+		return &RedisDelayedSyncError{Key: s.key, Phase: RedisDelayedSyncPhaseApply, Err: err}
+	}
+	switch reply[0] {
+	case "set":
+		// Case: The key is set by this server
+		r.lastSyncedResetAt.Store(s.key, s.resetAt)
+		r.lastSyncedReturned.Store(s.key, remoteReturned)
+		return nil
+	case "missing":
+		return nil
+	case "corrupted":
+		// Case: The remote value is corrupted, this could happen if redis server is restarted or if they were deleted
+		// See `RedisDelayedSyncCorruptedRemotePolicy` for the policy to handle this case, UPLOAD_LOCAL already uploaded lastSynced
+		switch r.corruptedRemotePolicy {
+		case RedisDelayedSyncCorruptedRemotePolicyUploadLocal:
+			// The tokens returned by the other servers are lost with the remote value
+			r.lastSyncedReturned.Store(s.key, remoteReturned)
+		case RedisDelayedSyncCorruptedRemotePolicyReset:
+			r.lastSyncedResetAt.Store(s.key, 0)
+		default:
+			return &RedisDelayedSyncError{Key: s.key, Phase: RedisDelayedSyncPhaseRecovery, Err: fmt.Errorf("invalid corrupted remote policy: %s", r.corruptedRemotePolicy)}
 		}
+		// The delta was not pushed, we add it back to the limiter and wait for the next sync.
+		// We could have done SET lastSynced + delta but it would result in a race condition
+		// where multiple servers could be setting the key at the same time and overwriting each other local delta.
+		s.limiter.AddDeltaSinceLastPop(s.delta)
+		return nil
+	case "synced":
+	default:
+		return &RedisDelayedSyncError{Key: s.key, Phase: RedisDelayedSyncPhaseApply, Err: fmt.Errorf("unexpected sync script reply: %v", reply)}
+	}
+	remoteValue, err := strconv.ParseInt(reply[1], 10, 64)
+	if err != nil {
+		return &RedisDelayedSyncError{Key: s.key, Phase: RedisDelayedSyncPhaseApply, Err: err}
 	}
-	if !hasSyncedBefore {
+	if !s.hasSyncedBefore {
 		// Case: The key is set by another server and the current server joins the cluster later
 		// If the remote value is greater than the local resetAt due to clock drifts between servers,
 		// this newly joined server will be penalized, we assume that the clock drift is not significant enough
 		// Besides, the clock drift disadvantage is not permanent
 		// After the first sync, the key will only sync the delta of the previously synced value and the next remote value
-		if remoteValue > resetAt {
-			limiter.IncrementResetAtBy(remoteValue - resetAt)
+		if remoteValue > s.resetAt {
+			s.limiter.IncrementResetAtBy(remoteValue - s.resetAt)
 		}
-		r.lastSyncedResetAt.Store(key, remoteValue)
+		r.lastSyncedResetAt.Store(s.key, remoteValue)
+		r.lastSyncedReturned.Store(s.key, remoteReturned)
 		return nil
 	}
-	// Case: The remote value is corrupted, this could happen if redis server is restarted or if they were deleted
-	// See `RedisDelayedSyncCorruptedRemotePolicy` for the policy to handle this case
-	if remoteValue < lastSynced.(int64) {
-		return r.executeCorruptedRemoteRecovery(key, limiter, delta, lastSynced.(int64))
-	}
 	// diff==0: if the key is not incremented by another server
 	// diff>0: if the key is incremented by another server
+	// diff<0: if another server returned more tokens than it consumed since the last sync
 	// this is the case where the clock drift could be an issue if the key is incremented by another server, the clock drift will affect calculation of the diff
-	diff := remoteValue - lastSynced.(int64) - delta
-	if resetAt < expiry && delta == 0 {
-		r.lastSyncedResetAt.Delete(key)
-		if diff == 0 {
-			expireIn := max(r.keyExpiry, time.Until(time.Unix(0, remoteValue)))
-			// this means that the redis key is in sync with the local resetAt value, meaning no other server has set the key in redis and we can expire the key in redis
-			r.redisClient.ExpireNX(r.ctx, key, expireIn)
-		}
+	diff := remoteValue - s.lastSynced - s.delta
+	if s.resetAt < expiry && s.delta == 0 {
+		// syncScript expired the redis key if diff==0, meaning no other server has set the key in redis
+		r.lastSyncedResetAt.Delete(s.key)
+		r.lastSyncedReturned.Delete(s.key)
 		return nil
 	}
-	if diff > 0 {
-		limiter.IncrementResetAtBy(diff)
+	if diff != 0 {
+		s.limiter.IncrementResetAtBy(diff)
 	}
-	r.lastSyncedResetAt.Store(key, remoteValue)
+	r.lastSyncedResetAt.Store(s.key, remoteValue)
+	r.lastSyncedReturned.Store(s.key, remoteReturned)
 	return nil
 }
 
+// returnedKey is the key that counts the nanoseconds returned to the key by every server, it only ever increases.
+// It is in the same slot of a redis cluster as the key: it takes the hash tag of the key, or the key itself as its hash tag if it has none.
+// A key without a hash tag that holds a '}' cannot be a hash tag, e.g. "a{}b" or "user}1", so the returnedKey takes a tag that hashes to the slot of the key.
+func returnedKey(key string) string {
+	if _, ok := hashTag(key); ok {
+		return key + ":returned"
+	}
+	if !strings.Contains(key, "}") {
+		return "{" + key + "}:returned"
+	}
+	return "{" + slotTags()[keySlot(key)] + "}:returned:" + key
+}
+
 // SyncKey is a helper that triggers a manual sync for a specific key.
 // Note : It's not thread-safe and should only be used in test scenarios or controlled debugging.
 func (r *RedisDelayedSync) SyncKey(key string) error {
-	return r.sync(key, -1)
+	if r.closed.Load() {
+		return ErrClosed
+	}
+	return r.sync(r.ctx, key, -1)
+}
+
+// SyncKeyCtx is SyncKey with the redis calls bound to ctx instead of the constructor ctx
+func (r *RedisDelayedSync) SyncKeyCtx(ctx context.Context, key string) error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+	return r.sync(ctx, key, -1)
 }
 
 // GetResetAt is a helper that returns the current resetAt value for a given key.
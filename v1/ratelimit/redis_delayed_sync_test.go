@@ -2,12 +2,18 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/yesyoukenspace/go-ratelimit/internal/test_utils"
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+	"github.com/yesyoukenspace/go-ratelimit/limiter/limitertest"
 )
 
 func TestRedisDelayedSync(t *testing.T) {
@@ -37,10 +43,10 @@ func TestRedisDelayedSync(t *testing.T) {
 		t.Run("diffs should be equal after a full cycle of sync if there are no actions in between", func(t *testing.T) {
 			randomString := test_utils.RandString(10)
 			_, _ = ratelimiterAlpha.ForceN(randomString, 1, 1, 1)
-			_ = ratelimiterAlpha.sync(randomString, 0)
+			_ = ratelimiterAlpha.sync(context.Background(), randomString, 0)
 			originalResetAtOfAlpha := ratelimiterAlpha.inner.GetLimiter(randomString).GetResetAt()
 
-			_ = ratelimiterBeta.sync(randomString, 0)
+			_ = ratelimiterBeta.sync(context.Background(), randomString, 0)
 			_, _ = ratelimiterBeta.ForceN(randomString, 1, 1, 1)
 			originalResetAtOfBeta := ratelimiterBeta.inner.GetLimiter(randomString).GetResetAt()
 
@@ -59,10 +65,10 @@ func TestRedisDelayedSync(t *testing.T) {
 			}
 
 			// full cycle of sync for both servers with no actions in between
-			_ = ratelimiterAlpha.sync(randomString, 0)
-			_ = ratelimiterBeta.sync(randomString, 0)
-			_ = ratelimiterAlpha.sync(randomString, 0)
-			_ = ratelimiterBeta.sync(randomString, 0)
+			_ = ratelimiterAlpha.sync(context.Background(), randomString, 0)
+			_ = ratelimiterBeta.sync(context.Background(), randomString, 0)
+			_ = ratelimiterAlpha.sync(context.Background(), randomString, 0)
+			_ = ratelimiterBeta.sync(context.Background(), randomString, 0)
 
 			diffA = ratelimiterAlpha.inner.GetLimiter(randomString).GetResetAt() - originalResetAtOfAlpha
 			diffB = ratelimiterBeta.inner.GetLimiter(randomString).GetResetAt() - originalResetAtOfBeta
@@ -81,7 +87,7 @@ func TestRedisDelayedSync(t *testing.T) {
 			if _, err := ratelimiterAlpha.ForceN(randomString, 600, 10, 10); err != nil {
 				t.Fatalf("failed to force: %v", err)
 			}
-			if err := ratelimiterAlpha.sync(randomString, 0); err != nil {
+			if err := ratelimiterAlpha.sync(context.Background(), randomString, 0); err != nil {
 				t.Fatalf("failed to sync: %v", err)
 			}
 			allowed, err := ratelimiterBeta.AllowN(randomString, 1, 10, 10)
@@ -92,7 +98,7 @@ func TestRedisDelayedSync(t *testing.T) {
 			if !allowed {
 				t.Fatalf("should be allowed")
 			}
-			if err := ratelimiterBeta.sync(randomString, 0); err != nil {
+			if err := ratelimiterBeta.sync(context.Background(), randomString, 0); err != nil {
 				t.Fatalf("failed to sync: %v", err)
 			}
 			allowed, err = ratelimiterBeta.AllowN(randomString, 1, 10, 10)
@@ -116,7 +122,7 @@ func TestRedisDelayedSync(t *testing.T) {
 			if _, err := ratelimiterAlpha.ForceN(randomString, 1, 10, 10); err != nil {
 				t.Fatalf("failed to force: %v", err)
 			}
-			if err := ratelimiterAlpha.sync(randomString, 0); err != nil {
+			if err := ratelimiterAlpha.sync(context.Background(), randomString, 0); err != nil {
 				t.Fatalf("failed to sync: %v", err)
 			}
 			time.Sleep(2 * time.Second)
@@ -127,11 +133,11 @@ func TestRedisDelayedSync(t *testing.T) {
 			if !allowed {
 				t.Fatalf("should be allowed")
 			}
-			if err := ratelimiterBeta.sync(randomString, 0); err != nil {
+			if err := ratelimiterBeta.sync(context.Background(), randomString, 0); err != nil {
 				t.Fatalf("failed to sync: %v", err)
 			}
 			resetAtBefore := ratelimiterAlpha.inner.GetLimiter(randomString).GetResetAt()
-			if err := ratelimiterAlpha.sync(randomString, 0); err != nil {
+			if err := ratelimiterAlpha.sync(context.Background(), randomString, 0); err != nil {
 				t.Fatalf("failed to sync: %v", err)
 			}
 			resetAtAfter := ratelimiterAlpha.inner.GetLimiter(randomString).GetResetAt()
@@ -145,8 +151,8 @@ func TestRedisDelayedSync(t *testing.T) {
 
 			randomString := test_utils.RandString(10)
 			_, _ = ratelimiterAlpha.ForceN(randomString, 2, 1, 1000)
-			_ = ratelimiterAlpha.sync(randomString, 0)
-			_ = ratelimiterBeta.sync(randomString, 0)
+			_ = ratelimiterAlpha.sync(context.Background(), randomString, 0)
+			_ = ratelimiterBeta.sync(context.Background(), randomString, 0)
 
 			var corrupt func()
 
@@ -171,21 +177,21 @@ func TestRedisDelayedSync(t *testing.T) {
 				{
 					scenario: func() {
 						_, _ = ratelimiterAlpha.ForceN(randomString, 3, 1, 1000)
-						_ = ratelimiterAlpha.syncAll()
+						_ = ratelimiterAlpha.syncAll(context.Background())
 						corrupt()
 						_, _ = ratelimiterBeta.ForceN(randomString, 5, 1, 1000)
-						_ = ratelimiterBeta.syncAll()
+						_ = ratelimiterBeta.syncAll(context.Background())
 					},
 					expectedDiff: 8 * time.Second,
 				},
 				{
 					scenario: func() {
 						_, _ = ratelimiterAlpha.ForceN(randomString, 3, 1, 1000)
-						_ = ratelimiterAlpha.syncAll()
+						_ = ratelimiterAlpha.syncAll(context.Background())
 						corrupt()
 						_, _ = ratelimiterAlpha.ForceN(randomString, 5, 1, 1000)
 						_, _ = ratelimiterBeta.ForceN(randomString, 7, 1, 1000)
-						_ = ratelimiterBeta.syncAll()
+						_ = ratelimiterBeta.syncAll(context.Background())
 						corrupt()
 					},
 					expectedDiff: 15 * time.Second,
@@ -195,12 +201,12 @@ func TestRedisDelayedSync(t *testing.T) {
 					// We lost delta of the sync that happened before the corruption
 					scenario: func() {
 						_, _ = ratelimiterAlpha.ForceN(randomString, 3, 1, 1000)
-						_ = ratelimiterAlpha.syncAll()
+						_ = ratelimiterAlpha.syncAll(context.Background())
 						corrupt()
 						_, _ = ratelimiterAlpha.ForceN(randomString, 5, 1, 1000)
 						_, _ = ratelimiterBeta.ForceN(randomString, 7, 1, 1000)
-						_ = ratelimiterBeta.syncAll()
-						_ = ratelimiterBeta.syncAll()
+						_ = ratelimiterBeta.syncAll(context.Background())
+						_ = ratelimiterBeta.syncAll(context.Background())
 					},
 
 					expectedDiff: 12 * time.Second,
@@ -226,10 +232,10 @@ func TestRedisDelayedSync(t *testing.T) {
 
 							testCase.scenario()
 							// full cycle of sync for both servers with no actions in between
-							_ = ratelimiterAlpha.syncAll()
-							_ = ratelimiterBeta.syncAll()
-							_ = ratelimiterAlpha.syncAll()
-							_ = ratelimiterBeta.syncAll()
+							_ = ratelimiterAlpha.syncAll(context.Background())
+							_ = ratelimiterBeta.syncAll(context.Background())
+							_ = ratelimiterAlpha.syncAll(context.Background())
+							_ = ratelimiterBeta.syncAll(context.Background())
 
 							diffA := ratelimiterAlpha.inner.GetLimiter(randomString).GetResetAt() - originalResetAtOfAlpha
 							diffB := ratelimiterBeta.inner.GetLimiter(randomString).GetResetAt() - originalResetAtOfBeta
@@ -252,12 +258,12 @@ func TestRedisDelayedSync(t *testing.T) {
 
 		randomString := test_utils.RandString(10)
 		_, _ = ratelimiterAlpha.ForceN(randomString, 2, 1, 1000)
-		_ = ratelimiterAlpha.sync(randomString, 0)
-		_ = ratelimiterBeta.sync(randomString, 0)
+		_ = ratelimiterAlpha.sync(context.Background(), randomString, 0)
+		_ = ratelimiterBeta.sync(context.Background(), randomString, 0)
 		// Corrupt the remote value
 		redisClient.Del(context.Background(), randomString)
-		_ = ratelimiterAlpha.sync(randomString, 0)
-		_ = ratelimiterBeta.sync(randomString, 0)
+		_ = ratelimiterAlpha.sync(context.Background(), randomString, 0)
+		_ = ratelimiterBeta.sync(context.Background(), randomString, 0)
 
 		lastSyncedResetAtOfAlpha, _ := ratelimiterAlpha.lastSyncedResetAt.Load(randomString)
 		lastSyncedResetAtOfBeta, _ := ratelimiterBeta.lastSyncedResetAt.Load(randomString)
@@ -276,7 +282,7 @@ func TestRedisDelayedSync(t *testing.T) {
 
 		randomString := test_utils.RandString(10)
 		_, _ = ratelimiterAlpha.ForceN(randomString, 3, 1, 1)
-		_ = ratelimiterAlpha.syncAll()
+		_ = ratelimiterAlpha.syncAll(context.Background())
 		lastSyncedResetAt, _ := ratelimiterAlpha.lastSyncedResetAt.Load(randomString)
 		if lastSyncedResetAt == 0 {
 			t.Fatalf("last synced reset at should be set")
@@ -284,7 +290,7 @@ func TestRedisDelayedSync(t *testing.T) {
 		// Even though key expiry is set to 1 second, the key is not expired yet
 		// because the key has a resetAt that is greater than the key supposed expiry
 		time.Sleep(time.Second * 1)
-		_ = ratelimiterAlpha.syncAll()
+		_ = ratelimiterAlpha.syncAll(context.Background())
 		_, exists := ratelimiterAlpha.lastSyncedResetAt.Load(randomString)
 		if !exists {
 			t.Fatalf("last synced reset at should be set")
@@ -292,7 +298,7 @@ func TestRedisDelayedSync(t *testing.T) {
 
 		// After 2 seconds, the key should be expired
 		time.Sleep(time.Second * 2)
-		_ = ratelimiterAlpha.syncAll()
+		_ = ratelimiterAlpha.syncAll(context.Background())
 		_, exists = ratelimiterAlpha.lastSyncedResetAt.Load(randomString)
 		if exists {
 			t.Fatalf("key should be deleted from lastSyncedResetAt")
@@ -360,3 +366,459 @@ func Test_GetResetAt_DefaultIsZero(t *testing.T) {
 		t.Fatalf("expected resetAt to be 0 for unused key, got %d", got)
 	}
 }
+
+func Test_SlidingWindowCounter_ShouldShareConsumption(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 9})
+	defer rdb.FlushDB(context.Background())
+
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	opt := RedisDelayedSyncOption{
+		RedisClient:     rdb,
+		DisableAutoSync: true,
+		Clock:           clock,
+		NewSyncableLimiterFn: func(clock limiter.Clock) limiter.SyncableLimiter {
+			return limiter.NewSlidingWindowCounterWithClock(clock)
+		},
+	}
+	alpha := NewRedisDelayedSync(context.Background(), opt)
+	beta := NewRedisDelayedSync(context.Background(), opt)
+
+	key := "test:slidingwindowcounter"
+	_, _ = alpha.ForceN(key, 6, 10, 10)
+	if err := alpha.SyncKey(key); err != nil {
+		t.Fatalf("SyncKey returned error: %v", err)
+	}
+	if allowed, _ := beta.AllowN(key, 1, 10, 10); !allowed {
+		t.Fatalf("beta should allow before it syncs")
+	}
+	if err := beta.SyncKey(key); err != nil {
+		t.Fatalf("SyncKey returned error: %v", err)
+	}
+	// beta counts the 6 tokens of alpha on top of its own
+	if allowed, _ := beta.AllowN(key, 4, 10, 10); allowed {
+		t.Fatalf("beta should deny beyond the shared window")
+	}
+	if allowed, _ := beta.AllowN(key, 3, 10, 10); !allowed {
+		t.Fatalf("beta should allow up to the shared window")
+	}
+	if err := alpha.SyncKey(key); err != nil {
+		t.Fatalf("SyncKey returned error: %v", err)
+	}
+	// alpha picks up the first token of beta
+	if allowed, _ := alpha.AllowN(key, 4, 10, 10); allowed {
+		t.Fatalf("alpha should deny beyond the shared window")
+	}
+	if allowed, _ := alpha.AllowN(key, 3, 10, 10); !allowed {
+		t.Fatalf("alpha should allow up to the shared window")
+	}
+}
+
+func Test_ReturnN_ShouldPropagateToOtherServers(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 9})
+	defer rdb.FlushDB(context.Background())
+
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	opt := RedisDelayedSyncOption{
+		RedisClient:     rdb,
+		DisableAutoSync: true,
+		Clock:           clock,
+	}
+	alpha := NewRedisDelayedSync(context.Background(), opt)
+	beta := NewRedisDelayedSync(context.Background(), opt)
+
+	key := "test:returnn"
+	_, _ = alpha.ForceN(key, 5, 10, 10)
+	_, _ = beta.ForceN(key, 5, 10, 10)
+	for _, rl := range []*RedisDelayedSync{alpha, beta, alpha} {
+		if err := rl.SyncKey(key); err != nil {
+			t.Fatalf("SyncKey returned error: %v", err)
+		}
+	}
+	if allowed, _ := beta.AllowN(key, 1, 10, 10); allowed {
+		t.Fatalf("beta should deny once the burst is shared")
+	}
+	if err := alpha.ReturnN(key, 5); err != nil {
+		t.Fatalf("ReturnN returned error: %v", err)
+	}
+	// The negative delta of alpha is pushed and picked up by beta, it is not mistaken for a corrupted remote
+	for _, rl := range []*RedisDelayedSync{alpha, beta} {
+		if err := rl.SyncKey(key); err != nil {
+			t.Fatalf("SyncKey returned error: %v", err)
+		}
+	}
+	if allowed, _ := beta.AllowN(key, 5, 10, 10); !allowed {
+		t.Fatalf("beta should allow the tokens returned by alpha")
+	}
+	if allowed, _ := beta.AllowN(key, 1, 10, 10); allowed {
+		t.Fatalf("beta should deny beyond the tokens returned by alpha")
+	}
+}
+
+func Test_ReturnN_ShouldNotHideCorruptedRemote(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 9})
+	defer rdb.FlushDB(context.Background())
+
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	opt := RedisDelayedSyncOption{
+		RedisClient:     rdb,
+		DisableAutoSync: true,
+		Clock:           clock,
+	}
+	alpha := NewRedisDelayedSync(context.Background(), opt)
+	beta := NewRedisDelayedSync(context.Background(), opt)
+
+	// The burst is large enough for any drop of the key to leave the limiters far from replenished
+	key := "test:returnn:corrupted"
+	burst := 1000000
+	_, _ = alpha.ForceN(key, 5, 1, burst)
+	_, _ = beta.ForceN(key, 5, 1, burst)
+	for _, rl := range []*RedisDelayedSync{alpha, beta, alpha} {
+		if err := rl.SyncKey(key); err != nil {
+			t.Fatalf("SyncKey returned error: %v", err)
+		}
+	}
+	synced := beta.GetResetAt(key)
+
+	// A drop that no server returned is a corrupted remote, beta uploads its lastSynced instead of giving the tokens back
+	rdb.Set(context.Background(), key, synced-int64(3*time.Second), 0)
+	if err := beta.SyncKey(key); err != nil {
+		t.Fatalf("SyncKey returned error: %v", err)
+	}
+	if got := beta.GetResetAt(key); got != synced {
+		t.Fatalf("expected beta to keep its reset at %d, got %d, off by %s", synced, got, time.Duration(got-synced))
+	}
+	if remote, _ := rdb.Get(context.Background(), key).Int64(); remote != synced {
+		t.Fatalf("expected the remote value to be recovered to %d, got %d", synced, remote)
+	}
+}
+
+func Test_SyncAll_ShouldSyncEveryKeyInBatches(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 9})
+	defer rdb.FlushDB(context.Background())
+
+	opt := RedisDelayedSyncOption{
+		RedisClient:     rdb,
+		DisableAutoSync: true,
+		SyncBatchSize:   7,
+	}
+	alpha := NewRedisDelayedSync(context.Background(), opt)
+	beta := NewRedisDelayedSync(context.Background(), opt)
+
+	keys := make([]string, 50)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("test:batch:%d", i)
+		_, _ = alpha.ForceN(keys[i], 10, 1, 10)
+		_, _ = beta.ForceN(keys[i], 0, 1, 10)
+	}
+	_ = alpha.syncAll(context.Background())
+	_ = beta.syncAll(context.Background())
+	for _, key := range keys {
+		if allowed, _ := beta.AllowN(key, 1, 1, 10); allowed {
+			t.Fatalf("%s: beta should deny once the consumption of alpha is synced", key)
+		}
+	}
+}
+
+func Test_SyncAll_ShouldNotLoseDeltasOfConcurrentServers(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 9})
+	defer rdb.FlushDB(context.Background())
+
+	// The clock does not move so that every token forced is still accounted for at the end
+	clock := limitertest.NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	opt := RedisDelayedSyncOption{
+		RedisClient:     rdb,
+		DisableAutoSync: true,
+		Clock:           clock,
+	}
+	servers := make([]*RedisDelayedSync, 4)
+	for i := range servers {
+		servers[i] = NewRedisDelayedSync(context.Background(), opt)
+	}
+	key := "test:concurrent"
+	burst := 1000000
+	rounds := 50
+
+	var wg sync.WaitGroup
+	for _, rl := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				_, _ = rl.ForceN(key, 1, 1, burst)
+				if err := rl.syncAll(context.Background()); err != nil {
+					t.Errorf("syncAll returned error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// A full cycle picks up the pushes the servers made after each other's last sync
+	for _, rl := range servers {
+		_ = rl.syncAll(context.Background())
+	}
+
+	// Every forced token is counted once in redis and in every server
+	want := clock.Now().Add(-time.Duration(burst) * time.Second).Add(time.Duration(len(servers)*rounds) * time.Second).UnixNano()
+	assertConverged := func(want int64) {
+		t.Helper()
+		remote, err := rdb.Get(context.Background(), key).Int64()
+		if err != nil {
+			t.Fatalf("failed to get the remote value: %v", err)
+		}
+		if remote != want {
+			t.Fatalf("expected the remote value %d, got %d, off by %s", want, remote, time.Duration(remote-want))
+		}
+		for i, rl := range servers {
+			if got := rl.GetResetAt(key); got != want {
+				t.Fatalf("server %d: expected reset at %d, got %d, off by %s", i, want, got, time.Duration(got-want))
+			}
+		}
+	}
+	assertConverged(want)
+
+	// The servers recover the lost key at the same time, the first one uploads lastSynced and the others push their delta on top of it
+	rdb.Del(context.Background(), key)
+	for _, rl := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = rl.ForceN(key, 1, 1, burst)
+			if err := rl.syncAll(context.Background()); err != nil {
+				t.Errorf("syncAll returned error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	for range 2 {
+		for _, rl := range servers {
+			_ = rl.syncAll(context.Background())
+		}
+	}
+	assertConverged(want + int64(len(servers))*int64(time.Second))
+}
+
+func Test_SyncAll_ShouldContinuePastKeyErrors(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 9})
+	defer rdb.FlushDB(context.Background())
+
+	var reported []error
+	rl := NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+		RedisClient:      rdb,
+		DisableAutoSync:  true,
+		SyncBatchSize:    1,
+		SyncErrorHandler: func(err error) { reported = append(reported, err) },
+	})
+	badKey := "test:bad"
+	rdb.Set(context.Background(), badKey, "not a number", 0)
+	keys := []string{badKey}
+	for i := range 5 {
+		keys = append(keys, fmt.Sprintf("test:good:%d", i))
+	}
+	for _, key := range keys {
+		_, _ = rl.ForceN(key, 1, 1, 10)
+	}
+
+	err := rl.syncAll(context.Background())
+	var syncErr *RedisDelayedSyncError
+	if !errors.As(err, &syncErr) || syncErr.Key != badKey || syncErr.Phase != RedisDelayedSyncPhaseScript {
+		t.Fatalf("expected the script error of %s, got %v", badKey, err)
+	}
+	if len(reported) != 1 || !errors.As(reported[0], &syncErr) || syncErr.Key != badKey {
+		t.Fatalf("expected the handler to get the error of %s only, got %v", badKey, reported)
+	}
+	// The keys synced after the bad key in the same cycle are not starved
+	for _, key := range keys[1:] {
+		if err := rdb.Get(context.Background(), key).Err(); err != nil {
+			t.Fatalf("%s: expected the key to be synced, got %v", key, err)
+		}
+	}
+}
+
+func Test_Close_ShouldFlushDeltasAndRejectLaterCalls(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 9})
+	defer rdb.FlushDB(context.Background())
+
+	// The auto sync loop never ticks, only Close pushes the consumption of alpha
+	alpha := NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+		RedisClient:  rdb,
+		SyncInterval: time.Hour,
+	})
+	beta := NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+		RedisClient:     rdb,
+		DisableAutoSync: true,
+	})
+	key := "test:close"
+	_, _ = beta.ForceN(key, 0, 1, 10)
+	_ = beta.SyncKey(key)
+	_, _ = alpha.ForceN(key, 10, 1, 10)
+
+	if err := alpha.Close(context.Background()); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	_ = beta.SyncKey(key)
+	if allowed, _ := beta.AllowN(key, 1, 1, 10); allowed {
+		t.Fatalf("beta should deny once the consumption of alpha is flushed")
+	}
+	if _, err := alpha.AllowN(key, 1, 1, 10); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after Close, got %v", err)
+	}
+	if err := alpha.ReturnN(key, 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after Close, got %v", err)
+	}
+	if err := alpha.Close(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed when closing twice, got %v", err)
+	}
+
+	t.Run("the flush is bound to the context", func(t *testing.T) {
+		_, _ = beta.ForceN(key, 1, 1, 10)
+		before, _ := rdb.Get(context.Background(), key).Int64()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := beta.Close(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the flush to be cancelled, got %v", err)
+		}
+		// The delta left by the cancelled flush is pushed by the next Close
+		if err := beta.Close(context.Background()); err != nil {
+			t.Fatalf("expected the next Close to flush, got %v", err)
+		}
+		if after, _ := rdb.Get(context.Background(), key).Int64(); after-before != int64(time.Second) {
+			t.Fatalf("expected the delta of 1s to be flushed, got %s", time.Duration(after-before))
+		}
+		if err := beta.Close(context.Background()); !errors.Is(err, ErrClosed) {
+			t.Fatalf("expected ErrClosed once flushed, got %v", err)
+		}
+	})
+
+	t.Run("a flush whose deadline passes mid-pipeline is finished by a later Close", func(t *testing.T) {
+		hook := &stallingHook{}
+		stalled := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 9})
+		stalled.AddHook(hook)
+		epsilon := NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+			RedisClient:     stalled,
+			DisableAutoSync: true,
+		})
+		key := "test:close:deadline"
+		_, _ = epsilon.ForceN(key, 1, 1, 10)
+		if err := epsilon.SyncKey(key); err != nil {
+			t.Fatalf("SyncKey returned error: %v", err)
+		}
+		before, _ := rdb.Get(context.Background(), key).Int64()
+		_, _ = epsilon.ForceN(key, 3, 1, 10)
+
+		hook.stall.Store(true)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := epsilon.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the flush to time out, got %v", err)
+		}
+		if remote, _ := rdb.Get(context.Background(), key).Int64(); remote != before {
+			t.Fatalf("expected nothing pushed by the timed out flush, got %s", time.Duration(remote-before))
+		}
+		hook.stall.Store(false)
+		if err := epsilon.Close(context.Background()); err != nil {
+			t.Fatalf("expected the next Close to flush, got %v", err)
+		}
+		if remote, _ := rdb.Get(context.Background(), key).Int64(); remote-before != int64(3*time.Second) {
+			t.Fatalf("expected the delta of 3s of the timed out flush to be pushed, got %s", time.Duration(remote-before))
+		}
+	})
+
+	t.Run("auto sync loops may be started concurrently with Close", func(t *testing.T) {
+		gamma := NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+			RedisClient:  rdb,
+			SyncInterval: time.Millisecond,
+		})
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				gamma.StartAutoSyncLoop()
+			}()
+		}
+		if err := gamma.Close(context.Background()); err != nil {
+			t.Fatalf("Close returned error: %v", err)
+		}
+		wg.Wait()
+		gamma.autoSyncLoops.Wait()
+	})
+}
+
+// stallingHook holds the pipelines until their ctx is done while stall is set, e.g. to pass the deadline of a flush in the middle of it
+type stallingHook struct {
+	stall atomic.Bool
+}
+
+func (h *stallingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *stallingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *stallingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if h.stall.Load() {
+			<-ctx.Done()
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func Test_Sync_ShouldReportConnectionErrors(t *testing.T) {
+	// Nothing listens on this port, the commands of the pipeline are not sent
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:1", MaxRetries: -1})
+	rl := NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+		RedisClient:     rdb,
+		DisableAutoSync: true,
+	})
+	_, _ = rl.ForceN("test:unreachable", 1, 1, 10)
+	err := rl.SyncKey("test:unreachable")
+	var syncErr *RedisDelayedSyncError
+	if !errors.As(err, &syncErr) || syncErr.Phase != RedisDelayedSyncPhaseScript || strings.Contains(err.Error(), "ParseInt") {
+		t.Fatalf("expected the connection error, got %v", err)
+	}
+}
+
+func Test_Sync_ShouldKeepDeltaOnScriptErrors(t *testing.T) {
+	// Nothing listens on this port, the commands of the pipeline are not sent
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:1", MaxRetries: -1})
+	rl := NewRedisDelayedSync(context.Background(), RedisDelayedSyncOption{
+		RedisClient:     rdb,
+		DisableAutoSync: true,
+	})
+	key := "test:unreachable"
+	_, _ = rl.ForceN(key, 5, 1, 10)
+	resetAt := rl.GetResetAt(key)
+	for range 2 {
+		if err := rl.SyncKey(key); err == nil {
+			t.Fatalf("expected the sync to fail")
+		}
+	}
+	// The failed syncs neither pushed nor dropped the delta of the 5 tokens
+	if got := rl.GetResetAt(key); got != resetAt {
+		t.Fatalf("expected resetAt to stay at %d, got %d", resetAt, got)
+	}
+	if delta := rl.inner.GetLimiter(key).PopResetAtDelta(); delta != int64(5*time.Second) {
+		t.Fatalf("expected a delta of 5s left for the next sync, got %s", time.Duration(delta))
+	}
+}
+
+func Test_ReturnedKey_ShouldShareTheSlotOfTheKey(t *testing.T) {
+	// The check value of CRC16-CCITT and the slot of "foo" given by CLUSTER KEYSLOT
+	for key, slot := range map[string]int{"123456789": 0x31c3, "foo": 12182} {
+		if got := keySlot(key); got != slot {
+			t.Fatalf("expected the slot of %q to be %d, got %d", key, slot, got)
+		}
+	}
+	// The examples of the hash tags of the redis cluster specification
+	if keySlot("{user1000}.following") != keySlot("user1000") || keySlot("foo{}{bar}") != int(crc16("foo{}{bar}")%redisClusterSlots) {
+		t.Fatalf("expected the hash tags to be found the way redis does")
+	}
+	for _, key := range []string{"user", "{user}1", "a{b", "a{}b", "user}1", "}{x}", "{}"} {
+		if keySlot(returnedKey(key)) != keySlot(key) {
+			t.Fatalf("expected %q and its returnedKey %q in the same slot", key, returnedKey(key))
+		}
+	}
+}
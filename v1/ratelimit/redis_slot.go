@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// redisClusterSlots is the number of hash slots of a redis cluster
+const redisClusterSlots = 16384
+
+// hashTag returns the hash tag of the key the way redis finds it: the part between the first '{' and the next '}' after it.
+// ok is false if there is no such part or if it is empty, redis then hashes the whole key.
+func hashTag(key string) (tag string, ok bool) {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return "", false
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return "", false
+	}
+	return key[start+1 : start+1+end], true
+}
+
+// keySlot returns the slot of the key in a redis cluster
+func keySlot(key string) int {
+	if tag, ok := hashTag(key); ok {
+		key = tag
+	}
+	return int(crc16(key) % redisClusterSlots)
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) checksum redis hashes the keys with
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// slotTags holds a hash tag for every slot, the shortest decimal number that hashes to it.
+// It is only built for the keys that cannot be given a hash tag of their own, see returnedKey.
+var slotTags = sync.OnceValue(func() *[redisClusterSlots]string {
+	var tags [redisClusterSlots]string
+	for i, filled := 0, 0; filled < redisClusterSlots; i++ {
+		tag := strconv.Itoa(i)
+		if slot := crc16(tag) % redisClusterSlots; tags[slot] == "" {
+			tags[slot] = tag
+			filled++
+		}
+	}
+	return &tags
+})
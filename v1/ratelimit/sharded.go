@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/yesyoukenspace/go-ratelimit/limiter"
+)
+
+type ShardedOption struct {
+	// Shards is the number of independently locked maps, it is rounded up to a power of two
+	// Defaults to 4 times GOMAXPROCS
+	Shards int
+}
+
+// Sharded is a keyed ratelimiter that hashes the keys to independently locked maps.
+// Striping the locks keeps write-heavy, high-cardinality workloads from contending on a single lock,
+// a case where `sync.Map` degrades.
+type Sharded[Limiter limiter.Limiter] struct {
+	shards       []shard[Limiter]
+	mask         uint64
+	newLimiterFn func() Limiter
+}
+
+type shard[Limiter limiter.Limiter] struct {
+	mu       sync.RWMutex
+	limiters map[string]*entry[Limiter]
+}
+
+var _ WaitingRatelimiter = &Sharded[limiter.Limiter]{}
+var _ DetailedRatelimiter = &Sharded[limiter.Limiter]{}
+var _ ReservingRatelimiter = &Sharded[limiter.Limiter]{}
+var _ ForcingRatelimiter = &Sharded[limiter.Limiter]{}
+var _ ReturningRatelimiter = &Sharded[limiter.Limiter]{}
+
+func NewSharded[Limiter limiter.Limiter](newLimiterFn func() Limiter, opt ShardedOption) *Sharded[Limiter] {
+	n := opt.Shards
+	if n <= 0 {
+		n = 4 * runtime.GOMAXPROCS(0)
+	}
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	shards := make([]shard[Limiter], size)
+	for i := range shards {
+		shards[i].limiters = make(map[string]*entry[Limiter])
+	}
+	return &Sharded[Limiter]{
+		shards:       shards,
+		mask:         uint64(size - 1),
+		newLimiterFn: newLimiterFn,
+	}
+}
+
+func (d *Sharded[Limiter]) GetLimiter(key string) Limiter {
+	s := &d.shards[xxhash.Sum64String(key)&d.mask]
+	s.mu.RLock()
+	e, ok := s.limiters[key]
+	s.mu.RUnlock()
+	if !ok {
+		s.mu.Lock()
+		if e, ok = s.limiters[key]; !ok {
+			e = newEntry(d.newLimiterFn())
+			s.limiters[key] = e
+		}
+		s.mu.Unlock()
+	}
+	return e.touch()
+}
+
+func (d *Sharded[Limiter]) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.GetLimiter(key).AllowN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *Sharded[Limiter]) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.GetLimiter(key).ForceN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *Sharded[Limiter]) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return limiter.Result{}, err
+	}
+	return limiter.AllowNDetailed(d.GetLimiter(key), cost, replenishPerSecond, burst), nil
+}
+
+func (d *Sharded[Limiter]) WaitN(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) error {
+	return limiter.WaitN(ctx, d.GetLimiter(key), cost, replenishPerSecond, burst)
+}
+
+// ReserveN reserves the tokens of the key, see `limiter.Limiter.ReserveN`
+func (d *Sharded[Limiter]) ReserveN(key string, cost int, replenishPerSecond float64, burst int) (*limiter.Reservation, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return nil, err
+	}
+	return d.GetLimiter(key).ReserveN(cost, replenishPerSecond, burst), nil
+}
+
+// ReturnN gives n tokens back to the limiter of the key, see `limiter.ReturnN`
+func (d *Sharded[Limiter]) ReturnN(key string, n int) error {
+	return limiter.ReturnN(d.GetLimiter(key), n)
+}
+
+// StartJanitor evicts keys according to opt until ctx is done
+func (d *Sharded[Limiter]) StartJanitor(ctx context.Context, opt JanitorOption) {
+	startJanitor(ctx, opt, d.sweep)
+}
+
+// sweep locks one shard at a time so that the other shards keep serving requests
+func (d *Sharded[Limiter]) sweep(opt JanitorOption, now time.Time) {
+	for i := range d.shards {
+		s := &d.shards[i]
+		s.mu.Lock()
+		for key, e := range s.limiters {
+			if e.shouldEvict(opt, now) {
+				delete(s.limiters, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -1,7 +1,9 @@
 package ratelimit
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/yesyoukenspace/go-ratelimit/limiter"
 )
@@ -11,7 +13,11 @@ type SyncMapLoadThenLoadOrStore[Limiter limiter.Limiter] struct {
 	newLimiterFn func() Limiter
 }
 
-var _ Ratelimiter = &SyncMapLoadThenLoadOrStore[limiter.Limiter]{}
+var _ WaitingRatelimiter = &SyncMapLoadThenLoadOrStore[limiter.Limiter]{}
+var _ DetailedRatelimiter = &SyncMapLoadThenLoadOrStore[limiter.Limiter]{}
+var _ ReservingRatelimiter = &SyncMapLoadThenLoadOrStore[limiter.Limiter]{}
+var _ ForcingRatelimiter = &SyncMapLoadThenLoadOrStore[limiter.Limiter]{}
+var _ ReturningRatelimiter = &SyncMapLoadThenLoadOrStore[limiter.Limiter]{}
 
 func NewSyncMapLoadThenLoadOrStore[Limiter limiter.Limiter](newLimiterFn func() Limiter) *SyncMapLoadThenLoadOrStore[Limiter] {
 	return &SyncMapLoadThenLoadOrStore[Limiter]{
@@ -20,31 +26,60 @@ func NewSyncMapLoadThenLoadOrStore[Limiter limiter.Limiter](newLimiterFn func()
 }
 
 func (d *SyncMapLoadThenLoadOrStore[Limiter]) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
-	l, ok := d.limiters.Load(key)
-	// if key is not found, then create a new limiter and store it
-	// reduces allocation by doing this
-	if !ok {
-		l, _ = d.limiters.LoadOrStore(key, d.newLimiterFn())
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
 	}
-	return l.(limiter.Limiter).AllowN(cost, replenishPerSecond, burst), nil
+	return d.GetLimiter(key).AllowN(cost, replenishPerSecond, burst), nil
 }
 
 func (d *SyncMapLoadThenLoadOrStore[Limiter]) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
-	l, ok := d.limiters.Load(key)
-	// if key is not found, then create a new limiter and store it
-	// reduces allocation by doing this
-	if !ok {
-		l, _ = d.limiters.LoadOrStore(key, d.newLimiterFn())
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.GetLimiter(key).ForceN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *SyncMapLoadThenLoadOrStore[Limiter]) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return limiter.Result{}, err
+	}
+	return limiter.AllowNDetailed(d.GetLimiter(key), cost, replenishPerSecond, burst), nil
+}
+
+func (d *SyncMapLoadThenLoadOrStore[Limiter]) WaitN(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) error {
+	return limiter.WaitN(ctx, d.GetLimiter(key), cost, replenishPerSecond, burst)
+}
+
+// ReserveN reserves the tokens of the key, see `limiter.Limiter.ReserveN`
+func (d *SyncMapLoadThenLoadOrStore[Limiter]) ReserveN(key string, cost int, replenishPerSecond float64, burst int) (*limiter.Reservation, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return nil, err
 	}
-	return l.(limiter.Limiter).ForceN(cost, replenishPerSecond, burst), nil
+	return d.GetLimiter(key).ReserveN(cost, replenishPerSecond, burst), nil
+}
+
+// ReturnN gives n tokens back to the limiter of the key, see `limiter.ReturnN`
+func (d *SyncMapLoadThenLoadOrStore[Limiter]) ReturnN(key string, n int) error {
+	return limiter.ReturnN(d.GetLimiter(key), n)
 }
 
 func (d *SyncMapLoadThenLoadOrStore[Limiter]) GetLimiter(key string) Limiter {
-	l, ok := d.limiters.Load(key)
+	e, ok := d.limiters.Load(key)
+	// if key is not found, then create a new limiter and store it
+	// reduces allocation by doing this
 	if !ok {
-		l, _ = d.limiters.LoadOrStore(key, d.newLimiterFn())
+		e, _ = d.limiters.LoadOrStore(key, newEntry(d.newLimiterFn()))
 	}
-	return l.(Limiter)
+	return e.(*entry[Limiter]).touch()
+}
+
+// StartJanitor evicts keys according to opt until ctx is done
+func (d *SyncMapLoadThenLoadOrStore[Limiter]) StartJanitor(ctx context.Context, opt JanitorOption) {
+	startJanitor(ctx, opt, d.sweep)
+}
+
+func (d *SyncMapLoadThenLoadOrStore[Limiter]) sweep(opt JanitorOption, now time.Time) {
+	sweepSyncMap[Limiter](&d.limiters, opt, now)
 }
 
 type SyncMapLoadOrStore[Limiter limiter.Limiter] struct {
@@ -58,19 +93,77 @@ func NewSyncMapLoadOrStore[Limiter limiter.Limiter](newLimiterFn func() Limiter)
 	}
 }
 
+func (d *SyncMapLoadOrStore[Limiter]) GetLimiter(key string) Limiter {
+	e, ok := d.limiters.Load(key)
+	if !ok {
+		e, _ = d.limiters.LoadOrStore(key, newEntry(d.newLimiterFn()))
+	}
+	return e.(*entry[Limiter]).touch()
+}
+
 func (d *SyncMapLoadOrStore[Limiter]) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
-	l, _ := d.limiters.LoadOrStore(key, d.newLimiterFn())
-	return l.(limiter.Limiter).AllowN(cost, replenishPerSecond, burst), nil
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.GetLimiter(key).AllowN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *SyncMapLoadOrStore[Limiter]) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return d.GetLimiter(key).ForceN(cost, replenishPerSecond, burst), nil
+}
+
+func (d *SyncMapLoadOrStore[Limiter]) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return limiter.Result{}, err
+	}
+	return limiter.AllowNDetailed(d.GetLimiter(key), cost, replenishPerSecond, burst), nil
+}
+
+func (d *SyncMapLoadOrStore[Limiter]) WaitN(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) error {
+	return limiter.WaitN(ctx, d.GetLimiter(key), cost, replenishPerSecond, burst)
+}
+
+// ReserveN reserves the tokens of the key, see `limiter.Limiter.ReserveN`
+func (d *SyncMapLoadOrStore[Limiter]) ReserveN(key string, cost int, replenishPerSecond float64, burst int) (*limiter.Reservation, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return nil, err
+	}
+	return d.GetLimiter(key).ReserveN(cost, replenishPerSecond, burst), nil
+}
+
+// ReturnN gives n tokens back to the limiter of the key, see `limiter.ReturnN`
+func (d *SyncMapLoadOrStore[Limiter]) ReturnN(key string, n int) error {
+	return limiter.ReturnN(d.GetLimiter(key), n)
 }
 
-var _ Ratelimiter = &SyncMapLoadOrStore[limiter.Limiter]{}
+// StartJanitor evicts keys according to opt until ctx is done
+func (d *SyncMapLoadOrStore[Limiter]) StartJanitor(ctx context.Context, opt JanitorOption) {
+	startJanitor(ctx, opt, d.sweep)
+}
+
+func (d *SyncMapLoadOrStore[Limiter]) sweep(opt JanitorOption, now time.Time) {
+	sweepSyncMap[Limiter](&d.limiters, opt, now)
+}
+
+var _ WaitingRatelimiter = &SyncMapLoadOrStore[limiter.Limiter]{}
+var _ DetailedRatelimiter = &SyncMapLoadOrStore[limiter.Limiter]{}
+var _ ReservingRatelimiter = &SyncMapLoadOrStore[limiter.Limiter]{}
+var _ ForcingRatelimiter = &SyncMapLoadOrStore[limiter.Limiter]{}
+var _ ReturningRatelimiter = &SyncMapLoadOrStore[limiter.Limiter]{}
 
 type SyncMapLoadThenStore[Limiter limiter.Limiter] struct {
 	limiters     sync.Map
 	newLimiterFn func() Limiter
 }
 
-var _ Ratelimiter = &SyncMapLoadThenStore[limiter.Limiter]{}
+var _ WaitingRatelimiter = &SyncMapLoadThenStore[limiter.Limiter]{}
+var _ DetailedRatelimiter = &SyncMapLoadThenStore[limiter.Limiter]{}
+var _ ReservingRatelimiter = &SyncMapLoadThenStore[limiter.Limiter]{}
+var _ ForcingRatelimiter = &SyncMapLoadThenStore[limiter.Limiter]{}
+var _ ReturningRatelimiter = &SyncMapLoadThenStore[limiter.Limiter]{}
 
 func NewSyncMapLoadThenStore[Limiter limiter.Limiter](newLimiterFn func() Limiter) *SyncMapLoadThenStore[Limiter] {
 	return &SyncMapLoadThenStore[Limiter]{
@@ -80,29 +173,68 @@ func NewSyncMapLoadThenStore[Limiter limiter.Limiter](newLimiterFn func() Limite
 }
 
 func (r *SyncMapLoadThenStore[Limiter]) AllowN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
-	l, ok := r.limiters.Load(key)
-	if !ok {
-		l = r.newLimiterFn()
-		// note: We might overwrite the limiter if multiple goroutines are trying to create the limiter at the same time, it is not a big deal as we may just have a little inaccurate rate limiting for a short period of time
-		r.limiters.Store(key, l)
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
 	}
-	return l.(Limiter).AllowN(cost, replenishPerSecond, burst), nil
+	return r.GetLimiter(key).AllowN(cost, replenishPerSecond, burst), nil
 }
 
 func (r *SyncMapLoadThenStore[Limiter]) ForceN(key string, cost int, replenishPerSecond float64, burst int) (bool, error) {
-	l, ok := r.limiters.Load(key)
-	if !ok {
-		l = r.newLimiterFn()
-		r.limiters.Store(key, l)
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return false, err
+	}
+	return r.GetLimiter(key).ForceN(cost, replenishPerSecond, burst), nil
+}
+
+func (r *SyncMapLoadThenStore[Limiter]) AllowNDetailed(key string, cost int, replenishPerSecond float64, burst int) (limiter.Result, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return limiter.Result{}, err
+	}
+	return limiter.AllowNDetailed(r.GetLimiter(key), cost, replenishPerSecond, burst), nil
+}
+
+func (r *SyncMapLoadThenStore[Limiter]) WaitN(ctx context.Context, key string, cost int, replenishPerSecond float64, burst int) error {
+	return limiter.WaitN(ctx, r.GetLimiter(key), cost, replenishPerSecond, burst)
+}
+
+// ReserveN reserves the tokens of the key, see `limiter.Limiter.ReserveN`
+func (r *SyncMapLoadThenStore[Limiter]) ReserveN(key string, cost int, replenishPerSecond float64, burst int) (*limiter.Reservation, error) {
+	if err := limiter.Validate(cost, replenishPerSecond, burst); err != nil {
+		return nil, err
 	}
-	return l.(Limiter).ForceN(cost, replenishPerSecond, burst), nil
+	return r.GetLimiter(key).ReserveN(cost, replenishPerSecond, burst), nil
+}
+
+// ReturnN gives n tokens back to the limiter of the key, see `limiter.ReturnN`
+func (r *SyncMapLoadThenStore[Limiter]) ReturnN(key string, n int) error {
+	return limiter.ReturnN(r.GetLimiter(key), n)
 }
 
 func (r *SyncMapLoadThenStore[Limiter]) GetLimiter(key string) Limiter {
-	l, ok := r.limiters.Load(key)
+	e, ok := r.limiters.Load(key)
 	if !ok {
-		l = r.newLimiterFn()
-		r.limiters.Store(key, l)
+		e = newEntry(r.newLimiterFn())
+		// note: We might overwrite the limiter if multiple goroutines are trying to create the limiter at the same time, it is not a big deal as we may just have a little inaccurate rate limiting for a short period of time
+		r.limiters.Store(key, e)
 	}
-	return l.(Limiter)
+	return e.(*entry[Limiter]).touch()
+}
+
+// StartJanitor evicts keys according to opt until ctx is done
+func (r *SyncMapLoadThenStore[Limiter]) StartJanitor(ctx context.Context, opt JanitorOption) {
+	startJanitor(ctx, opt, r.sweep)
+}
+
+func (r *SyncMapLoadThenStore[Limiter]) sweep(opt JanitorOption, now time.Time) {
+	sweepSyncMap[Limiter](&r.limiters, opt, now)
+}
+
+func sweepSyncMap[Limiter limiter.Limiter](limiters *sync.Map, opt JanitorOption, now time.Time) {
+	limiters.Range(func(key, value any) bool {
+		if e := value.(*entry[Limiter]); e.shouldEvict(opt, now) {
+			// CompareAndDelete avoids deleting an entry that was replaced since it was loaded
+			limiters.CompareAndDelete(key, e)
+		}
+		return true
+	})
 }